@@ -16,6 +16,10 @@ func String(paramName string, envName string, fallback string, desc string) *str
 	return flag_with_env.String(paramName, envName, fallback, desc)
 }
 
+func Bool(paramName string, envName string, fallback bool, desc string) *bool {
+	return flag_with_env.Bool(paramName, envName, fallback, desc)
+}
+
 func Array(paramName string, desc string) *flag_with_env.ArrayParam {
 	return flag_with_env.Array(paramName, desc)
 }
@@ -8,11 +8,11 @@ import (
 
 func New() logger.LoggerI {
 	logrus := logrus.New()
-	return &WrapLogrus{Logger: *logrus}
+	return &WrapLogrus{Logger: logrus}
 }
 
 type WrapLogrus struct {
-	logrus.Logger
+	*logrus.Logger
 }
 
 func (w *WrapLogrus) SetLevel(level logger.Level) error {
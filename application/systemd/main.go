@@ -2,16 +2,21 @@ package systemd
 
 import "systemd-cd/domain/model/systemd"
 
-func New(s systemd.Systemctl, unitFileDir string) (systemd.ISystemd, error) {
-	return systemd.New(s, unitFileDir)
+func New(s systemd.Systemctl, unitFileDir string, o Option) (systemd.ISystemd, error) {
+	return systemd.New(s, unitFileDir, o)
 }
 
 type (
+	Option           = systemd.Option
 	UnitFileService  = systemd.UnitFileService
 	UnitDirective    = systemd.UnitDirective
 	UnitType         = systemd.UnitType
 	ServiceDirective = systemd.ServiceDirective
+	ExecCommand      = systemd.ExecCommand
 	InstallDirective = systemd.InstallDirective
+	UnitFileTarget   = systemd.UnitFileTarget
+	DesiredUnit      = systemd.DesiredUnit
+	EnvChange        = systemd.EnvChange
 )
 
 var (
@@ -22,3 +27,7 @@ var (
 	UnitTypeNotify  = systemd.UnitTypeNotify
 	UnitTypeIdle    = systemd.UnitTypeIdle
 )
+
+func ResolveExecPath(cmd string, path string) (string, error) {
+	return systemd.ResolveExecPath(cmd, path)
+}
@@ -14,6 +14,10 @@ func String(paramName string, envName string, fallback string, desc string) *str
 	return flag.String(paramName, getEnv(envName, fallback), desc)
 }
 
+func Bool(paramName string, envName string, fallback bool, desc string) *bool {
+	return flag.Bool(paramName, getBoolEnv(envName, fallback), desc)
+}
+
 type ArrayParam []string
 
 // Implements for flag.Value
@@ -19,6 +19,20 @@ func getUintEnv(key string, fallback uint) uint {
 	return fallback
 }
 
+// bool型で環境変数取得
+func getBoolEnv(key string, fallback bool) bool {
+	// 環境変数取得
+	if value, ok := os.LookupEnv(key); ok {
+		// bool型に変換
+		var boolValue, err = strconv.ParseBool(value)
+		if err == nil {
+			return boolValue
+		}
+	}
+	// bool型に変換失敗 または 環境変数が設定されていない場合、引数に指定したfallbackを返す
+	return fallback
+}
+
 // string型で環境変数取得
 func getEnv(key, fallback string) string {
 	// 環境変数取得
@@ -5,16 +5,22 @@ import (
 )
 
 var (
-	ErrRepositoryNotExists = errors.New("repository does not exist")
+	ErrRepositoryNotExists   = errors.New("repository does not exist")
+	ErrRemoteBranchNotExists = errors.New("remote branch does not exist")
 )
 
 type GitCommand interface {
 	Clone(path Path, remoteUrl string, targetBranch string, recursive bool) error
 	Fetch(workingDir Path) error
 	DiffExists(workingDir Path, to string) (exists bool, err error)
+	RemoteRefCommitId(workingDir Path, branch string) (string, error)
 	Pull(workingDir Path, force bool) (refCommitId string, err error)
 	Status(workingDir Path) (string, error)
 	RefCommitId(workingDir Path) (string, error)
 	RefBranchName(workingDir Path) (string, error)
 	GetRemoteUrl(workingDir Path, remoteName string) (string, error)
+	// Remove untracked and ignored files (`git clean -fdx`) except `excludes`
+	Clean(workingDir Path, excludes []string) error
+	// Discard changes of tracked files (`git reset --hard`)
+	Reset(workingDir Path) error
 }
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake of git command for testing.
+type fakeGitCommand struct {
+	// Duration of clone/fetch
+	delay time.Duration
+
+	// commit id of branches on each remote url (nil: any branch exists)
+	branches map[string]map[string]string
+
+	mu sync.Mutex
+	// remote url of each working dir
+	remotes map[Path]string
+	// current/max number of concurrent clone/fetch per remote url
+	running    map[string]int
+	maxRunning map[string]int
+	// max number of concurrent clone/fetch of all remotes
+	runningAll    int
+	maxRunningAll int
+
+	// executed commands. e.g. `clean /src/app`, `reset /src/app`
+	calls []string
+	// excludes of last `Clean()`
+	cleanExcludes []string
+}
+
+func newFakeGitCommand(delay time.Duration) *fakeGitCommand {
+	return &fakeGitCommand{
+		delay:      delay,
+		remotes:    map[Path]string{},
+		running:    map[string]int{},
+		maxRunning: map[string]int{},
+	}
+}
+
+func (g *fakeGitCommand) run(remoteUrl string) {
+	g.mu.Lock()
+	g.running[remoteUrl]++
+	g.runningAll++
+	if g.running[remoteUrl] > g.maxRunning[remoteUrl] {
+		g.maxRunning[remoteUrl] = g.running[remoteUrl]
+	}
+	if g.runningAll > g.maxRunningAll {
+		g.maxRunningAll = g.runningAll
+	}
+	g.mu.Unlock()
+
+	time.Sleep(g.delay)
+
+	g.mu.Lock()
+	g.running[remoteUrl]--
+	g.runningAll--
+	g.mu.Unlock()
+}
+
+func (g *fakeGitCommand) Clone(path Path, remoteUrl string, targetBranch string, recursive bool) error {
+	g.run(remoteUrl)
+	if _, ok := g.branches[remoteUrl][targetBranch]; g.branches != nil && !ok {
+		return ErrRemoteBranchNotExists
+	}
+	g.mu.Lock()
+	g.remotes[path] = remoteUrl
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *fakeGitCommand) Fetch(workingDir Path) error {
+	g.mu.Lock()
+	remoteUrl := g.remotes[workingDir]
+	g.mu.Unlock()
+	g.run(remoteUrl)
+	return nil
+}
+
+func (g *fakeGitCommand) DiffExists(workingDir Path, to string) (exists bool, err error) {
+	return false, nil
+}
+
+func (g *fakeGitCommand) RemoteRefCommitId(workingDir Path, branch string) (string, error) {
+	g.mu.Lock()
+	remoteUrl, ok := g.remotes[workingDir]
+	g.mu.Unlock()
+	if !ok {
+		return "", ErrRepositoryNotExists
+	}
+	commitId, ok := g.branches[remoteUrl][branch]
+	if !ok {
+		return "", ErrRemoteBranchNotExists
+	}
+	return commitId, nil
+}
+
+func (g *fakeGitCommand) Pull(workingDir Path, force bool) (refCommitId string, err error) {
+	g.mu.Lock()
+	remoteUrl := g.remotes[workingDir]
+	g.mu.Unlock()
+	g.run(remoteUrl)
+	return "0000000000000000000000000000000000000000", nil
+}
+
+func (g *fakeGitCommand) Status(workingDir Path) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.remotes[workingDir]; !ok {
+		return "", ErrRepositoryNotExists
+	}
+	return "", nil
+}
+
+func (g *fakeGitCommand) RefCommitId(workingDir Path) (string, error) {
+	return "0000000000000000000000000000000000000000", nil
+}
+
+func (g *fakeGitCommand) RefBranchName(workingDir Path) (string, error) {
+	return "main", nil
+}
+
+func (g *fakeGitCommand) GetRemoteUrl(workingDir Path, remoteName string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.remotes[workingDir], nil
+}
+
+func (g *fakeGitCommand) Clean(workingDir Path, excludes []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls = append(g.calls, "clean "+string(workingDir))
+	g.cleanExcludes = excludes
+	return nil
+}
+
+func (g *fakeGitCommand) Reset(workingDir Path) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls = append(g.calls, "reset "+string(workingDir))
+	return nil
+}
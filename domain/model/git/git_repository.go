@@ -21,7 +21,9 @@ func (git *Git) NewLocalRepository(path Path, remoteUrl string, branch string) (
 	}
 
 	// Clone
+	release := git.hostSemaphore.acquire(remoteUrl)
 	err = git.command.Clone(path, remoteUrl, branch, true)
+	release()
 	if err != nil {
 		return
 	}
@@ -71,7 +73,10 @@ func (git *Git) OpenLocalRepository(path Path) (repo *RepositoryLocal, err error
 }
 
 func (r *RepositoryLocal) Pull(force bool) (refCommitId string, err error) {
+	// pull fetches remote
+	release := r.git.hostSemaphore.acquire(r.RemoteUrl)
 	refCommitId, err = r.git.command.Pull(r.Path, force)
+	release()
 	if err != nil {
 		return
 	}
@@ -79,7 +84,23 @@ func (r *RepositoryLocal) Pull(force bool) (refCommitId string, err error) {
 	return
 }
 
+// Restore pristine checkout before build if `Option.CleanCheckout` is set.
+// Files modified or generated by previous build are discarded,
+// except paths in `Option.CleanCheckoutIgnore`.
+func (r *RepositoryLocal) CleanCheckout() error {
+	if !r.git.option.CleanCheckout {
+		return nil
+	}
+	err := r.git.command.Reset(r.Path)
+	if err != nil {
+		return err
+	}
+	return r.git.command.Clean(r.Path, r.git.option.CleanCheckoutIgnore)
+}
+
 func (r *RepositoryLocal) fetch() error {
+	release := r.git.hostSemaphore.acquire(r.RemoteUrl)
+	defer release()
 	return r.git.command.Fetch(r.Path)
 }
 
@@ -92,3 +113,14 @@ func (r *RepositoryLocal) DiffExists(executeFetch bool) (exists bool, err error)
 	}
 	return r.git.command.DiffExists(r.Path, r.TargetBranch)
 }
+
+// Get commit id of remote target branch.
+func (r *RepositoryLocal) RemoteRefCommitId(executeFetch bool) (refCommitId string, err error) {
+	if executeFetch {
+		err = r.fetch()
+		if err != nil {
+			return
+		}
+	}
+	return r.git.command.RemoteRefCommitId(r.Path, r.TargetBranch)
+}
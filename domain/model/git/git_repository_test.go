@@ -0,0 +1,54 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepositoryLocal_CleanCheckout(t *testing.T) {
+	tests := []struct {
+		name             string
+		option           Option
+		wantCalls        []string
+		wantCleanExclude []string
+	}{
+		{
+			name:      "disabled",
+			option:    Option{},
+			wantCalls: nil,
+		},
+		{
+			name:      "clean and reset",
+			option:    Option{CleanCheckout: true},
+			wantCalls: []string{"reset /src/app", "clean /src/app"},
+		},
+		{
+			name:             "keep ignored paths",
+			option:           Option{CleanCheckout: true, CleanCheckoutIgnore: []string{"node_modules", ".cache"}},
+			wantCalls:        []string{"reset /src/app", "clean /src/app"},
+			wantCleanExclude: []string{"node_modules", ".cache"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newFakeGitCommand(0)
+			cmd.remotes["/src/app"] = "https://github.com/tingtt/app.git"
+			g := New(cmd, tt.option)
+			repo, err := g.OpenLocalRepository("/src/app")
+			if err != nil {
+				t.Fatalf("OpenLocalRepository() error = %v", err)
+			}
+
+			err = repo.CleanCheckout()
+			if err != nil {
+				t.Errorf("CleanCheckout() error = %v", err)
+			}
+			if !reflect.DeepEqual(cmd.calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", cmd.calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(cmd.cleanExcludes, tt.wantCleanExclude) {
+				t.Errorf("clean excludes = %v, want %v", cmd.cleanExcludes, tt.wantCleanExclude)
+			}
+		})
+	}
+}
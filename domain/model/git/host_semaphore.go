@@ -0,0 +1,65 @@
+package git
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Limit concurrent operations per git remote host.
+type hostSemaphore struct {
+	limit     int
+	overrides map[string]int
+
+	mu  sync.Mutex
+	sem map[string]chan struct{}
+}
+
+func newHostSemaphore(o Option) *hostSemaphore {
+	return &hostSemaphore{
+		limit:     o.MaxConcurrentFetchPerHost,
+		overrides: o.MaxConcurrentFetchOverride,
+		sem:       map[string]chan struct{}{},
+	}
+}
+
+// Block until operation to host of `remoteUrl` is available.
+// Returned func releases it.
+func (h *hostSemaphore) acquire(remoteUrl string) (release func()) {
+	host := remoteHost(remoteUrl)
+
+	limit := h.limit
+	if l, ok := h.overrides[host]; ok {
+		limit = l
+	}
+	if limit <= 0 {
+		// unlimited
+		return func() {}
+	}
+
+	h.mu.Lock()
+	sem, ok := h.sem[host]
+	if !ok {
+		sem = make(chan struct{}, limit)
+		h.sem[host] = sem
+	}
+	h.mu.Unlock()
+
+	sem <- struct{}{}
+	return func() { <-sem }
+}
+
+// Get host from git remote url.
+// e.g. `https://github.com/tingtt/systemd-cd.git`, `git@github.com:tingtt/systemd-cd.git`
+func remoteHost(remoteUrl string) string {
+	if u, err := url.Parse(remoteUrl); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+
+	// scp-like syntax (`[user@]host:path`)
+	host, _, _ := strings.Cut(remoteUrl, ":")
+	if i := strings.LastIndex(host, "@"); i != -1 {
+		host = host[i+1:]
+	}
+	return host
+}
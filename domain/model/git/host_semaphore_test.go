@@ -0,0 +1,108 @@
+package git
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_remoteHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		remoteUrl string
+		want      string
+	}{
+		{name: "https", remoteUrl: "https://github.com/tingtt/systemd-cd.git", want: "github.com"},
+		{name: "https with port", remoteUrl: "https://git.example.com:8443/a/b.git", want: "git.example.com"},
+		{name: "ssh", remoteUrl: "ssh://git@gitlab.com:22/a/b.git", want: "gitlab.com"},
+		{name: "scp-like", remoteUrl: "git@github.com:tingtt/systemd-cd.git", want: "github.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remoteHost(tt.remoteUrl); got != tt.want {
+				t.Errorf("remoteHost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryLocal_fetch_concurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		o    Option
+		// remote urls of repositories fetched concurrently
+		remotes []string
+		// fetch by `Pull()` instead of `DiffExists()`
+		pull       bool
+		wantMaxAll int
+	}{
+		{
+			name:       "same host serialized",
+			o:          Option{MaxConcurrentFetchPerHost: 1},
+			remotes:    []string{"https://github.com/a/a.git", "https://github.com/a/b.git", "git@github.com:a/c.git"},
+			wantMaxAll: 1,
+		},
+		{
+			name:       "different hosts concurrently",
+			o:          Option{MaxConcurrentFetchPerHost: 1},
+			remotes:    []string{"https://github.com/a/a.git", "https://gitlab.com/a/b.git"},
+			wantMaxAll: 2,
+		},
+		{
+			name: "per-host override",
+			o: Option{
+				MaxConcurrentFetchPerHost:  1,
+				MaxConcurrentFetchOverride: map[string]int{"git.example.com": 2},
+			},
+			remotes:    []string{"https://git.example.com/a/a.git", "https://git.example.com/a/b.git"},
+			wantMaxAll: 2,
+		},
+		{
+			name:       "pull same host serialized",
+			o:          Option{MaxConcurrentFetchPerHost: 1},
+			remotes:    []string{"https://github.com/a/a.git", "https://github.com/a/b.git"},
+			pull:       true,
+			wantMaxAll: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newFakeGitCommand(20 * time.Millisecond)
+			g := New(cmd, Option{})
+			repos := []*RepositoryLocal{}
+			for i, remote := range tt.remotes {
+				r, err := g.NewLocalRepository(Path(strconv.Itoa(i)), remote, "main")
+				if err != nil {
+					t.Fatal(err)
+				}
+				repos = append(repos, r)
+			}
+			cmd.maxRunningAll = 0
+
+			// Fetch with limits
+			g.hostSemaphore = newHostSemaphore(tt.o)
+			wg := sync.WaitGroup{}
+			for _, r := range repos {
+				wg.Add(1)
+				go func(r *RepositoryLocal) {
+					defer wg.Done()
+					var err error
+					if tt.pull {
+						_, err = r.Pull(false)
+					} else {
+						_, err = r.DiffExists(true)
+					}
+					if err != nil {
+						t.Error(err)
+					}
+				}(r)
+			}
+			wg.Wait()
+
+			if cmd.maxRunningAll != tt.wantMaxAll {
+				t.Errorf("max concurrent fetch = %v, want %v", cmd.maxRunningAll, tt.wantMaxAll)
+			}
+		})
+	}
+}
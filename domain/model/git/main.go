@@ -1,9 +1,32 @@
 package git
 
-func New(git GitCommand) *Git {
-	return &Git{command: git}
+type Option struct {
+	// Max number of concurrent clone/fetch per git remote host (0: unlimited)
+	MaxConcurrentFetchPerHost int
+	// Override `MaxConcurrentFetchPerHost` for specific host
+	MaxConcurrentFetchOverride map[string]int
+	// Clean checkout by `CleanCheckout()` (removes build caches not in `CleanCheckoutIgnore`)
+	CleanCheckout bool
+	// Paths kept on clean checkout. e.g. `node_modules`
+	CleanCheckoutIgnore []string
+}
+
+func New(git GitCommand, o Option) *Git {
+	return &Git{command: git, hostSemaphore: newHostSemaphore(o), option: o}
 }
 
 type Git struct {
-	command GitCommand
+	command       GitCommand
+	hostSemaphore *hostSemaphore
+	option        Option
+}
+
+// Check remote repository resolves to deployable commit without deploying.
+// Clone (or fetch if already cloned) to `path` and resolve remote target branch.
+func (git *Git) ValidateRemote(path Path, remoteUrl string, branch string) (refCommitId string, err error) {
+	repo, err := git.NewLocalRepository(path, remoteUrl, branch)
+	if err != nil {
+		return
+	}
+	return repo.RemoteRefCommitId(true)
 }
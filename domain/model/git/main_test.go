@@ -0,0 +1,71 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestGit_ValidateRemote(t *testing.T) {
+	branches := map[string]map[string]string{
+		"https://github.com/tingtt/app.git": {
+			"main":    "1111111111111111111111111111111111111111",
+			"release": "2222222222222222222222222222222222222222",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		remoteUrl string
+		branch    string
+		cloned    bool
+		want      string
+		wantErr   error
+	}{
+		{
+			name:      "resolve branch",
+			remoteUrl: "https://github.com/tingtt/app.git",
+			branch:    "release",
+			want:      "2222222222222222222222222222222222222222",
+			wantErr:   nil,
+		},
+		{
+			name:      "resolve branch of cloned repository",
+			remoteUrl: "https://github.com/tingtt/app.git",
+			branch:    "main",
+			cloned:    true,
+			want:      "1111111111111111111111111111111111111111",
+			wantErr:   nil,
+		},
+		{
+			name:      "missing branch",
+			remoteUrl: "https://github.com/tingtt/app.git",
+			branch:    "develop",
+			wantErr:   ErrRemoteBranchNotExists,
+		},
+		{
+			name:      "missing branch of cloned repository",
+			remoteUrl: "https://github.com/tingtt/app.git",
+			branch:    "develop",
+			cloned:    true,
+			wantErr:   ErrRemoteBranchNotExists,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newFakeGitCommand(0)
+			cmd.branches = branches
+			if tt.cloned {
+				cmd.remotes["/src/app"] = tt.remoteUrl
+			}
+			g := New(cmd, Option{})
+
+			got, err := g.ValidateRemote("/src/app", tt.remoteUrl, tt.branch)
+			if err != tt.wantErr {
+				t.Errorf("ValidateRemote() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ValidateRemote() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package systemd
+
+import (
+	"errors"
+	"sort"
+)
+
+// Placeholder of env values in `EnvChange`
+const maskedValue = "********"
+
+type (
+	EnvChangeType string
+
+	// Key-level change of env, values are masked.
+	EnvChange struct {
+		Key  string
+		Type EnvChangeType
+		// Masked current value (empty if added)
+		Old string
+		// Masked desired value (empty if removed)
+		New string
+	}
+)
+
+const (
+	EnvAdded   EnvChangeType = "added"
+	EnvRemoved EnvChangeType = "removed"
+	EnvChanged EnvChangeType = "changed"
+)
+
+// Diff env `current` to `desired` without revealing values.
+// Changes are sorted by key.
+func DiffEnvironment(current, desired map[string]string) []EnvChange {
+	changes := []EnvChange{}
+	for k, v := range desired {
+		cv, ok := current[k]
+		if !ok {
+			changes = append(changes, EnvChange{Key: k, Type: EnvAdded, New: maskedValue})
+		} else if cv != v {
+			changes = append(changes, EnvChange{Key: k, Type: EnvChanged, Old: maskedValue, New: maskedValue})
+		}
+	}
+	for k := range current {
+		if _, ok := desired[k]; !ok {
+			changes = append(changes, EnvChange{Key: k, Type: EnvRemoved, Old: maskedValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// Diff managed env file of unit to `env` (dry-run), files are not changed.
+// Fails with `ErrUnitEnvFileNotManaged` if file not generated by systemd-cd.
+func (s Systemd) EnvironmentChanges(name string, uf UnitFileService, env map[string]string) ([]EnvChange, error) {
+	uf = s.placeEnvironmentFile(name, uf, env)
+	if uf.Service.EnvironmentFile == nil {
+		// env values are ignored without env file
+		return []EnvChange{}, nil
+	}
+
+	path, _ := environmentFilePath(*uf.Service.EnvironmentFile)
+	current, isGeneratedBySystemdCd, err := s.loadEnvFile(path)
+	if errors.Is(err, ErrNoSuchFileOrDir) {
+		// env file not exists
+		return DiffEnvironment(nil, env), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isGeneratedBySystemdCd {
+		return nil, ErrUnitEnvFileNotManaged
+	}
+	return DiffEnvironment(current, env), nil
+}
@@ -0,0 +1,86 @@
+package systemd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffEnvironment(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]string
+		desired map[string]string
+		want    []EnvChange
+	}{
+		{
+			name:    "no changes",
+			current: map[string]string{"PORT": "8080", "TOKEN": "secret"},
+			desired: map[string]string{"TOKEN": "secret", "PORT": "8080"},
+			want:    []EnvChange{},
+		},
+		{
+			name:    "added, removed and changed",
+			current: map[string]string{"PORT": "8080", "TOKEN": "old-secret", "DEBUG": "1"},
+			desired: map[string]string{"PORT": "8080", "TOKEN": "new-secret", "API_KEY": "key"},
+			want: []EnvChange{
+				{Key: "API_KEY", Type: EnvAdded, New: maskedValue},
+				{Key: "DEBUG", Type: EnvRemoved, Old: maskedValue},
+				{Key: "TOKEN", Type: EnvChanged, Old: maskedValue, New: maskedValue},
+			},
+		},
+		{
+			name:    "no current env",
+			current: nil,
+			desired: map[string]string{"PORT": "8080"},
+			want:    []EnvChange{{Key: "PORT", Type: EnvAdded, New: maskedValue}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffEnvironment(tt.current, tt.desired)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffEnvironment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemd_EnvironmentChanges(t *testing.T) {
+	dir := t.TempDir() + "/"
+	s, err := New(newFakeSystemctl(dir), dir, Option{EnvironmentFileDir: dir + "env/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uf := UnitFileService{
+		Unit:    UnitDirective{Description: "app"},
+		Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+	}
+	_, err = s.NewService("app", uf, map[string]string{"PORT": "8080", "TOKEN": "old-secret"})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	got, err := s.EnvironmentChanges("app", uf, map[string]string{"PORT": "8080", "TOKEN": "new-secret"})
+	if err != nil {
+		t.Fatalf("EnvironmentChanges() error = %v", err)
+	}
+	want := []EnvChange{{Key: "TOKEN", Type: EnvChanged, Old: maskedValue, New: maskedValue}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvironmentChanges() = %v, want %v", got, want)
+	}
+
+	// env file is not changed
+	loaded, _, err := s.loadEnvFile(dir + "env/app.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded["TOKEN"] != "old-secret" {
+		t.Errorf("env file changed by EnvironmentChanges(), TOKEN = %v", loaded["TOKEN"])
+	}
+	for _, c := range got {
+		if strings.Contains(c.Old+c.New, "secret") {
+			t.Errorf("EnvironmentChanges() revealed value: %v", c)
+		}
+	}
+}
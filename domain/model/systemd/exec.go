@@ -0,0 +1,150 @@
+package systemd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrExecPathNotResolved = errors.New("executable not found in PATH")
+	ErrExecNotAllowed      = errors.New("executable not allowed")
+)
+
+// Special executable prefixes of `Exec*=` (e.g. `-`, `@`, `+`)
+const execPrefixes = "-@:+!"
+
+// Command line of `Exec*=` directives.
+type ExecCommand struct {
+	// Prefix `-`: failure of command is ignored
+	IgnoreFailure bool
+	// Prefix `@`: second word of command is passed as argv[0]
+	OverrideArgv0 bool
+	// Prefix `+`: command is executed with full privileges
+	FullPrivileges bool
+	// Command line without modeled prefixes
+	Command string
+}
+
+// Parse command line with special executable prefixes in any order.
+// Unmodeled prefixes (e.g. `:`, `!`) are kept in `Command`.
+func ParseExecCommand(s string) ExecCommand {
+	c := ExecCommand{}
+	unmodeled := ""
+	for len(s) > 0 {
+		switch s[0] {
+		case '-':
+			c.IgnoreFailure = true
+		case '@':
+			c.OverrideArgv0 = true
+		case '+':
+			c.FullPrivileges = true
+		case ':', '!':
+			unmodeled += s[:1]
+		default:
+			c.Command = unmodeled + s
+			return c
+		}
+		s = s[1:]
+	}
+	c.Command = unmodeled
+	return c
+}
+
+// Command line with special executable prefixes.
+func (c ExecCommand) String() string {
+	prefix := ""
+	if c.IgnoreFailure {
+		prefix += "-"
+	}
+	if c.OverrideArgv0 {
+		prefix += "@"
+	}
+	if c.FullPrivileges {
+		prefix += "+"
+	}
+	return prefix + c.Command
+}
+
+func execCommandStrings(c []ExecCommand) []string {
+	if len(c) == 0 {
+		return nil
+	}
+	s := make([]string, len(c))
+	for i, c := range c {
+		s[i] = c.String()
+	}
+	return s
+}
+
+func execCommands(s []string) []ExecCommand {
+	if len(s) == 0 {
+		return nil
+	}
+	c := make([]ExecCommand, len(s))
+	for i, s := range s {
+		c[i] = ParseExecCommand(s)
+	}
+	return c
+}
+
+func isAbsoluteExecPath(cmd string) bool {
+	return strings.HasPrefix(strings.TrimLeft(cmd, execPrefixes), "/")
+}
+
+// Executable of command line (first word without special prefixes).
+func execBinary(cmd string) string {
+	bin, _, _ := strings.Cut(strings.TrimLeft(cmd, execPrefixes), " ")
+	return bin
+}
+
+// Check executable of `cmd` is listed in `allowlist`.
+// Entry of `allowlist` is absolute path of executable or directory.
+// Empty `allowlist` allows all executables.
+func isExecAllowed(cmd string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	bin := filepath.Clean(execBinary(cmd))
+	for _, a := range allowlist {
+		a = filepath.Clean(a)
+		if bin == a || strings.HasPrefix(bin, strings.TrimSuffix(a, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrite executable of `cmd` to absolute path resolved in `path`.
+// `path` is colon separated list of directories (same as `PATH` env).
+// If executable is already absolute path, returns `cmd` as it is.
+func ResolveExecPath(cmd string, path string) (string, error) {
+	if isAbsoluteExecPath(cmd) {
+		return cmd, nil
+	}
+
+	rest := strings.TrimLeft(cmd, execPrefixes)
+	prefix := cmd[:len(cmd)-len(rest)]
+	bin, args, _ := strings.Cut(rest, " ")
+	if strings.Contains(bin, "/") {
+		// relative path (e.g. `./bin/app`) cannot be resolved
+		return "", ErrExecPathNotResolved
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		candidate := filepath.Join(dir, bin)
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		if args != "" {
+			return prefix + candidate + " " + args, nil
+		}
+		return prefix + candidate, nil
+	}
+	return "", ErrExecPathNotResolved
+}
@@ -0,0 +1,159 @@
+package systemd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestResolveExecPath(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(dir+"/yarn", []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/noexec", []byte(""), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cmd     string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "already absolute",
+			cmd:     "/usr/bin/app --port 80",
+			path:    dir,
+			want:    "/usr/bin/app --port 80",
+			wantErr: nil,
+		},
+		{
+			name:    "resolve with args",
+			cmd:     "yarn start",
+			path:    "/nonexistent:" + dir,
+			want:    dir + "/yarn start",
+			wantErr: nil,
+		},
+		{
+			name:    "resolve keeps prefix",
+			cmd:     "-yarn",
+			path:    dir,
+			want:    "-" + dir + "/yarn",
+			wantErr: nil,
+		},
+		{
+			name:    "not found",
+			cmd:     "node server.js",
+			path:    dir,
+			wantErr: ErrExecPathNotResolved,
+		},
+		{
+			name:    "not executable",
+			cmd:     "noexec",
+			path:    dir,
+			wantErr: ErrExecPathNotResolved,
+		},
+		{
+			name:    "relative path",
+			cmd:     "./yarn",
+			path:    dir,
+			wantErr: ErrExecPathNotResolved,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveExecPath(tt.cmd, tt.path)
+			if err != tt.wantErr {
+				t.Errorf("ResolveExecPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveExecPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExecCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          string
+		want       ExecCommand
+		wantString string
+	}{
+		{
+			name:       "no prefix",
+			s:          "/usr/bin/app",
+			want:       ExecCommand{Command: "/usr/bin/app"},
+			wantString: "/usr/bin/app",
+		},
+		{
+			name:       "ignore failure",
+			s:          "-/usr/bin/migrate",
+			want:       ExecCommand{IgnoreFailure: true, Command: "/usr/bin/migrate"},
+			wantString: "-/usr/bin/migrate",
+		},
+		{
+			name:       "override argv0",
+			s:          "@/usr/bin/app app-name",
+			want:       ExecCommand{OverrideArgv0: true, Command: "/usr/bin/app app-name"},
+			wantString: "@/usr/bin/app app-name",
+		},
+		{
+			name:       "full privileges",
+			s:          "+/usr/bin/setup",
+			want:       ExecCommand{FullPrivileges: true, Command: "/usr/bin/setup"},
+			wantString: "+/usr/bin/setup",
+		},
+		{
+			name:       "all prefixes",
+			s:          "-@+/usr/bin/app app",
+			want:       ExecCommand{IgnoreFailure: true, OverrideArgv0: true, FullPrivileges: true, Command: "/usr/bin/app app"},
+			wantString: "-@+/usr/bin/app app",
+		},
+		{
+			name:       "prefixes in other order",
+			s:          "+-/usr/bin/setup",
+			want:       ExecCommand{IgnoreFailure: true, FullPrivileges: true, Command: "/usr/bin/setup"},
+			wantString: "-+/usr/bin/setup",
+		},
+		{
+			name:       "unmodeled prefix",
+			s:          "-:/usr/bin/app",
+			want:       ExecCommand{IgnoreFailure: true, Command: ":/usr/bin/app"},
+			wantString: "-:/usr/bin/app",
+		},
+		{
+			name:       "unmodeled prefix before modeled",
+			s:          ":-/bin/x",
+			want:       ExecCommand{IgnoreFailure: true, Command: ":/bin/x"},
+			wantString: "-:/bin/x",
+		},
+		{
+			name:       "unmodeled prefixes between modeled",
+			s:          "!!-@/usr/bin/app app",
+			want:       ExecCommand{IgnoreFailure: true, OverrideArgv0: true, Command: "!!/usr/bin/app app"},
+			wantString: "-@!!/usr/bin/app app",
+		},
+		{
+			name:       "mixed prefixes",
+			s:          "+:!-/usr/bin/setup",
+			want:       ExecCommand{IgnoreFailure: true, FullPrivileges: true, Command: ":!/usr/bin/setup"},
+			wantString: "-+:!/usr/bin/setup",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseExecCommand(tt.s)
+			if got != tt.want {
+				t.Errorf("ParseExecCommand() = %v, want %v", got, tt.want)
+			}
+			if s := got.String(); s != tt.wantString {
+				t.Errorf("ExecCommand.String() = %v, want %v", s, tt.wantString)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import "errors"
 
 var (
 	ErrUnitStatusCannotUnmarshal = errors.New("cannot unmarshal stdout `systemctl is-active`")
+	ErrUnitVerifyFailed          = errors.New("`systemd-analyze verify` failed")
 )
 
 type Systemctl interface {
@@ -12,6 +13,12 @@ type Systemctl interface {
 	Disable(service string, stopNow bool) error
 	Start(service string) error
 	Stop(service string) error
+	// Enqueue stop job without waiting it completes (`systemctl stop --no-block`)
+	StopNoBlock(service string) error
 	Restart(service string) error
+	Reload(service string) error
+	Kill(service string, signal string) error
 	Status(service string) (Status, error)
+	// Verify unit file by `systemd-analyze verify`
+	Verify(unitFilePath string) error
 }
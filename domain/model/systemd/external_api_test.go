@@ -0,0 +1,264 @@
+package systemd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fake of `systemctl` for testing.
+// Symlinks are emulated on `links` (link name -> unit name),
+// `WantedBy=` symlinks are emulated on `wants` (target -> unit names).
+type fakeSystemctl struct {
+	unitFileDir string
+	calls       []string
+	links       map[string]string
+	wants       map[string][]string
+	status      map[string]Status
+	// Units ignore `systemctl stop` (kept deactivating on `StopNoBlock()`)
+	ignoreStop map[string]bool
+	// Units ignore `systemctl kill -s SIGKILL`
+	ignoreKill map[string]bool
+	// Error of `systemctl daemon-reload`
+	daemonReloadErr error
+	// Called on `systemctl daemon-reload`
+	onDaemonReload func()
+	// Error of `systemd-analyze verify`
+	verifyErr error
+	// Errors returned by `systemctl restart` in order (nil: restarted)
+	restartErrs map[string][]error
+	// Number of restarts resulting `failed` status
+	failRestarts map[string]int
+}
+
+func newFakeSystemctl(unitFileDir string) *fakeSystemctl {
+	return &fakeSystemctl{
+		unitFileDir:  unitFileDir,
+		links:        map[string]string{},
+		wants:        map[string][]string{},
+		status:       map[string]Status{},
+		ignoreStop:   map[string]bool{},
+		ignoreKill:   map[string]bool{},
+		restartErrs:  map[string][]error{},
+		failRestarts: map[string]int{},
+	}
+}
+
+func (s *fakeSystemctl) DaemonReload() error {
+	s.calls = append(s.calls, "daemon-reload")
+	if s.onDaemonReload != nil {
+		s.onDaemonReload()
+	}
+	return s.daemonReloadErr
+}
+
+func (s *fakeSystemctl) Enable(service string, startNow bool) error {
+	s.calls = append(s.calls, "enable "+service)
+
+	// Same as `systemctl`, read [Install] section from unit file
+	aliases, err := s.directiveValues(service, "Alias")
+	if err != nil {
+		return err
+	}
+	s.links[service+".service"] = service
+	for _, a := range aliases {
+		s.links[a] = service
+	}
+	wantedBy, err := s.directiveValues(service, "WantedBy")
+	if err != nil {
+		return err
+	}
+	for _, t := range wantedBy {
+		s.wants[t] = append(s.wants[t], service)
+	}
+	// Same as `systemctl`, enable `Also=` units with their own [Install] section
+	also, err := s.directiveValues(service, "Also")
+	if err != nil {
+		return err
+	}
+	for _, a := range also {
+		s.links[a] = a
+		wantedBy, err := s.companionDirectiveValues(a, "WantedBy")
+		if err != nil {
+			return err
+		}
+		for _, t := range wantedBy {
+			s.wants[t] = append(s.wants[t], a)
+		}
+	}
+
+	if startNow {
+		s.status[service] = StatusRunning
+	}
+	return nil
+}
+
+func (s *fakeSystemctl) Disable(service string, stopNow bool) error {
+	s.calls = append(s.calls, "disable "+service)
+
+	// Same as `systemctl`, remove all symlinks to the unit and its `Also=` units
+	also, err := s.directiveValues(service, "Also")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, unit := range append([]string{service}, also...) {
+		for l, u := range s.links {
+			if u == unit {
+				delete(s.links, l)
+			}
+		}
+		for t, units := range s.wants {
+			for i, u := range units {
+				if u == unit {
+					s.wants[t] = append(units[:i], units[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	if stopNow {
+		s.status[service] = StatusStopped
+	}
+	return nil
+}
+
+func (s *fakeSystemctl) Start(service string) error {
+	s.calls = append(s.calls, "start "+service)
+	s.status[service] = StatusRunning
+	// Same as `systemctl`, start units wanted by target
+	for _, u := range s.wants[service] {
+		s.status[u] = StatusRunning
+	}
+	return nil
+}
+
+func (s *fakeSystemctl) Stop(service string) error {
+	s.calls = append(s.calls, "stop "+service)
+	if !s.ignoreStop[service] {
+		s.status[service] = StatusStopped
+	}
+	// Same as `systemctl`, stop units `PartOf=` target
+	if strings.HasSuffix(service, ".target") {
+		units, err := s.partOf(service)
+		if err != nil {
+			return err
+		}
+		for _, u := range units {
+			s.status[u] = StatusStopped
+		}
+	}
+	return nil
+}
+
+func (s *fakeSystemctl) StopNoBlock(service string) error {
+	s.calls = append(s.calls, "stop --no-block "+service)
+	if s.ignoreStop[service] {
+		// stop job is running
+		s.status[service] = StatusTransitioning
+		return nil
+	}
+	s.status[service] = StatusStopped
+	return nil
+}
+
+func (s *fakeSystemctl) Restart(service string) error {
+	s.calls = append(s.calls, "restart "+service)
+	if errs := s.restartErrs[service]; len(errs) != 0 {
+		s.restartErrs[service] = errs[1:]
+		if errs[0] != nil {
+			return errs[0]
+		}
+	}
+	if s.failRestarts[service] > 0 {
+		s.failRestarts[service]--
+		s.status[service] = StatusFailed
+		return nil
+	}
+	s.status[service] = StatusRunning
+	return nil
+}
+
+func (s *fakeSystemctl) Reload(service string) error {
+	s.calls = append(s.calls, "reload "+service)
+	return nil
+}
+
+func (s *fakeSystemctl) Kill(service string, signal string) error {
+	s.calls = append(s.calls, "kill -s "+signal+" "+service)
+	if signal == "SIGKILL" && !s.ignoreKill[service] {
+		s.status[service] = StatusStopped
+	}
+	return nil
+}
+
+func (s *fakeSystemctl) Status(service string) (Status, error) {
+	st, ok := s.status[service]
+	if !ok {
+		return StatusStopped, nil
+	}
+	return st, nil
+}
+
+func (s *fakeSystemctl) Verify(unitFilePath string) error {
+	s.calls = append(s.calls, "verify "+filepath.Base(unitFilePath))
+	return s.verifyErr
+}
+
+// Services having `PartOf=` target
+func (s *fakeSystemctl) partOf(target string) ([]string, error) {
+	entries, err := os.ReadDir(s.unitFileDir)
+	if err != nil {
+		return nil, err
+	}
+	units := []string{}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".service") {
+			continue
+		}
+		service := strings.TrimSuffix(e.Name(), ".service")
+		partOf, err := s.directiveValues(service, "PartOf")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range partOf {
+			if p == target {
+				units = append(units, service)
+			}
+		}
+	}
+	return units, nil
+}
+
+func (s *fakeSystemctl) directiveValues(service string, key string) ([]string, error) {
+	// services are called without suffix
+	fileName := service
+	if !strings.HasSuffix(service, ".target") {
+		fileName += ".service"
+	}
+	return s.fileDirectiveValues(fileName, key)
+}
+
+// Read directive of `Also=` unit (called with suffix), nil if unit file not exists
+func (s *fakeSystemctl) companionDirectiveValues(unit string, key string) ([]string, error) {
+	values, err := s.fileDirectiveValues(unit, key)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return values, err
+}
+
+func (s *fakeSystemctl) fileDirectiveValues(fileName string, key string) ([]string, error) {
+	b := &bytes.Buffer{}
+	err := readFile(s.unitFileDir+fileName, b)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(l, key+"=") {
+			return strings.Fields(strings.TrimPrefix(l, key+"=")), nil
+		}
+	}
+	return nil, nil
+}
@@ -3,12 +3,18 @@ package systemd
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"systemd-cd/domain/model/toml"
+	"text/template"
 )
 
+// Annotation to distinct files generated by systemd-cd
+const annotation = "#! Generated by systemd-cd\n"
+
 var (
 	ErrNoSuchFileOrDir       = errors.New("no such file or directory")
 	ErrUnitFileNotManaged    = errors.New("unit file not managed by systemd-cd")
@@ -17,19 +23,59 @@ var (
 
 type ISystemd interface {
 	NewService(name string, uf UnitFileService, env map[string]string) (UnitService, error)
+	NewServiceFromTemplate(name string, t *template.Template, uf UnitFileService, env map[string]string) (UnitService, error)
 	DeleteService(u UnitService) error
+	NewTarget(name string, uf UnitFileTarget) (UnitTarget, error)
+	DeleteTarget(u UnitTarget) error
+	Prepare(desired []DesiredUnit) (Plan, error)
+	Commit(p Plan) error
+	DaemonReload() error
+	ReloadPending() bool
+	EnvironmentChanges(name string, uf UnitFileService, env map[string]string) ([]EnvChange, error)
 
 	loadUnitFileSerivce(path string) (u UnitFileService, isGeneratedBySystemdCd bool, err error)
-	writeUnitFileService(u UnitFileService, path string) error
+	writeUnitFileService(u UnitFileService, t *template.Template, path string) error
+
+	loadUnitFileTarget(path string) (u UnitFileTarget, isGeneratedBySystemdCd bool, err error)
+	writeUnitFileTarget(u UnitFileTarget, path string) error
 
 	loadEnvFile(path string) (e map[string]string, isGeneratedBySystemdCd bool, err error)
 	writeEnvFile(e map[string]string, path string) error
 }
 
-func New(s Systemctl, unitFileDir string) (ISystemd, error) {
+type Option struct {
+	// Allow unit actions affecting host (e.g. `StartLimitAction=reboot`)
+	AllowDangerousActions bool
+	// Umask of generated unit/env files (nil: process umask)
+	Umask *os.FileMode
+	// Directory to place env files, if `EnvironmentFile=` not specified.
+	// Env file is generated to `<EnvironmentFileDir>/<name>.env`.
+	// (empty: env values are ignored without `EnvironmentFile=`)
+	EnvironmentFileDir string
+	// Absolute paths of executables or directories allowed in `Exec*=`
+	// (empty: all executables are allowed)
+	ExecAllowlist []string
+	// Version of systemd on host, directives requiring newer systemd are rejected
+	// (0: unknown, treated as oldest)
+	SystemdVersion uint
+	// Skip daemon-reload after changing unit files,
+	// call `DaemonReload()` to apply pending changes.
+	NoReload bool
+	// Check `User=` and `Group=` exist on host before writing unit file
+	CheckPrincipals bool
+	// Create missing `User=` as system user (requires `CheckPrincipals`)
+	CreateUser bool
+	// Resolve relative `ExecStart=` executable in `ExecPath` before rendering
+	// (false: relative `ExecStart=` is rejected)
+	ResolveExecPath bool
+	// Colon separated directories to resolve executables (empty: `PATH` env)
+	ExecPath string
+}
+
+func New(s Systemctl, unitFileDir string, o Option) (ISystemd, error) {
 	// check `unitFileDir`
 	// TODO: if invalid dir path, print warning
-	err := mkdirIfNotExist(unitFileDir)
+	err := mkdirIfNotExist(unitFileDir, o.Umask)
 	if err != nil {
 		return Systemd{}, err
 	}
@@ -38,82 +84,214 @@ func New(s Systemctl, unitFileDir string) (ISystemd, error) {
 		// add trailing slash
 		unitFileDir += "/"
 	}
-	return Systemd{s, unitFileDir}, nil
+
+	if o.EnvironmentFileDir != "" {
+		// check `EnvironmentFileDir`
+		err := mkdirIfNotExist(o.EnvironmentFileDir, o.Umask)
+		if err != nil {
+			return Systemd{}, err
+		}
+		if !strings.HasSuffix(o.EnvironmentFileDir, "/") {
+			// add trailing slash
+			o.EnvironmentFileDir += "/"
+		}
+	}
+
+	return Systemd{s, unitFileDir, o, &reloadState{}}, nil
 }
 
 type Systemd struct {
 	systemctl   Systemctl
 	unitFileDir string
+	option      Option
+	reload      *reloadState
 }
 
 // Generate unit-file.
 // If unit-file already exists, replace it.
 func (s Systemd) NewService(name string, uf UnitFileService, env map[string]string) (UnitService, error) {
-	// load unit file
-	path := strings.Join([]string{s.unitFileDir, name, ".service"}, "")
-	loaded, isGeneratedBySystemdCd, err := s.loadUnitFileSerivce(path)
-	if err != nil && !os.IsNotExist(err) {
-		// fail
+	return s.newService(name, uf, nil, env)
+}
+
+// Generate unit-file rendered by `t` instead of `MarshalUnitFile()`.
+// Template receives `uf` as data.
+// If unit-file already exists, replace it.
+func (s Systemd) NewServiceFromTemplate(name string, t *template.Template, uf UnitFileService, env map[string]string) (UnitService, error) {
+	return s.newService(name, uf, t, env)
+}
+
+func (s Systemd) newService(name string, uf UnitFileService, t *template.Template, env map[string]string) (UnitService, error) {
+	uf = s.placeEnvironmentFile(name, uf, env)
+	uf, err := s.resolveExecStart(uf)
+	if err != nil {
 		return UnitService{}, err
 	}
 
-	if os.IsNotExist(err) {
-		// unit file not exists
-		// generate `.service` file to `path`
-		err = s.writeUnitFileService(uf, path)
-	} else if isGeneratedBySystemdCd {
-		// unit file already exists and file generated by systemd-cd
-		if !loaded.Equals(uf) {
-			// file has changes
-			// update `.service` file to `path`
-			err = s.writeUnitFileService(uf, path)
+	// validate
+	err = validateUnitFileService(name, uf, s.option)
+	if err != nil {
+		return UnitService{}, err
+	}
+	err = validateEnvironment(env)
+	if err != nil {
+		return UnitService{}, err
+	}
+	err = s.checkPrincipals(uf)
+	if err != nil {
+		return UnitService{}, err
+	}
+	var rendered []byte
+	if t != nil {
+		// validate rendered unit file
+		rendered, err = ExecuteUnitFileTemplate(t, uf)
+		if err != nil {
+			return UnitService{}, err
+		}
+		parsed, err := UnmarshalUnitFile(bytes.NewBuffer(rendered))
+		if err != nil {
+			return UnitService{}, err
+		}
+		err = validateUnitFileService(name, parsed, s.option)
+		if err != nil {
+			return UnitService{}, err
 		}
-	} else {
-		// unit file already exists and file not generated by systemd-cd
-		err = ErrUnitFileNotManaged
 	}
+
+	// generate or update `.service` file
+	path := strings.Join([]string{s.unitFileDir, name, ".service"}, "")
+	unitFileChanged, err := s.unitFileServiceChanged(uf, t, rendered, path)
 	if err != nil {
 		// fail
 		return UnitService{}, err
 	}
-
-	if uf.Service.EnvironmentFile != nil {
-		// load env file
-		envPath := *uf.Service.EnvironmentFile
-		loaded, isGeneratedBySystemdCd, err := s.loadEnvFile(envPath)
-		if err != nil && !os.IsNotExist(err) {
+	if unitFileChanged {
+		err = s.writeUnitFileService(uf, t, path)
+		if err != nil {
 			// fail
 			return UnitService{}, err
 		}
+	}
 
-		if os.IsNotExist(err) {
-			// unit file not exists
-			// generate env file to `envPath`
-			err = s.writeEnvFile(env, envPath)
-		} else if isGeneratedBySystemdCd {
-			// unit file already exists and file generated by systemd-cd
-			if !reflect.DeepEqual(env, loaded) {
-				// file has changes
-				// update env file to `envPath`
-				err = s.writeEnvFile(env, envPath)
-			}
-		} else {
-			// unit file already exists and file not generated by systemd-cd
-			err = ErrUnitEnvFileNotManaged
-		}
+	// generate or update env file
+	envFileChanged := false
+	if uf.Service.EnvironmentFile != nil {
+		envPath, optional := environmentFilePath(*uf.Service.EnvironmentFile)
+		envFileChanged, err = s.envFileChanged(env, envPath, optional)
 		if err != nil {
 			// fail
 			return UnitService{}, err
 		}
+		if envFileChanged {
+			err = mkdirIfNotExist(filepath.Dir(envPath), s.option.Umask)
+			if err == nil {
+				err = s.writeEnvFile(env, envPath)
+			}
+			if err != nil {
+				// fail
+				return UnitService{}, err
+			}
+		}
 	}
 
 	// daemon-reload
-	err = s.systemctl.DaemonReload()
+	if unitFileChanged || envFileChanged {
+		err = s.daemonReload()
+	}
 
-	return UnitService{s.systemctl, name, uf, path, env}, err
+	return UnitService{
+		systemctl:              s.systemctl,
+		Name:                   name,
+		unitFile:               uf,
+		Path:                   path,
+		EnvironmentFileValues:  env,
+		UnitFileChanged:        unitFileChanged,
+		EnvironmentFileChanged: envFileChanged,
+		reload:                 s.reload,
+	}, err
 }
 
+// Set `EnvironmentFile=` to managed directory, if not specified.
+func (s Systemd) placeEnvironmentFile(name string, uf UnitFileService, env map[string]string) UnitFileService {
+	if uf.Service.EnvironmentFile == nil && len(env) != 0 && s.option.EnvironmentFileDir != "" {
+		// place env file to managed directory
+		envPath := s.option.EnvironmentFileDir + name + ".env"
+		uf.Service.EnvironmentFile = &envPath
+	}
+	return uf
+}
+
+// Rewrite relative `ExecStart=` executable to absolute path if `Option.ResolveExecPath`.
+// Executables searched by systemd in `ExecSearchPath=` are kept as it is.
+func (s Systemd) resolveExecStart(uf UnitFileService) (UnitFileService, error) {
+	if !s.option.ResolveExecPath || len(uf.Service.ExecSearchPath) != 0 || uf.Service.ExecStart.Command == "" {
+		return uf, nil
+	}
+	path := s.option.ExecPath
+	if path == "" {
+		path = os.Getenv("PATH")
+	}
+	cmd, err := ResolveExecPath(uf.Service.ExecStart.Command, path)
+	if err != nil {
+		return uf, fmt.Errorf("%w: %s", err, execBinary(uf.Service.ExecStart.Command))
+	}
+	uf.Service.ExecStart.Command = cmd
+	return uf, nil
+}
+
+// Check unit file at `path` needs to be generated or updated.
+// Fails with `ErrUnitFileNotManaged` if file not generated by systemd-cd.
+func (s Systemd) unitFileServiceChanged(uf UnitFileService, t *template.Template, rendered []byte, path string) (bool, error) {
+	loaded, isGeneratedBySystemdCd, err := s.loadUnitFileSerivce(path)
+	if errors.Is(err, ErrNoSuchFileOrDir) {
+		// unit file not exists
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !isGeneratedBySystemdCd {
+		// unit file already exists and file not generated by systemd-cd
+		return false, ErrUnitFileNotManaged
+	}
+	if t != nil {
+		// compare rendered content,
+		// template may contain directives not in `UnitFileService`
+		return fileChanged(path, append([]byte(annotation), rendered...))
+	}
+	return !loaded.Equals(uf), nil
+}
+
+// Path of `EnvironmentFile=` value.
+// `-` prefix: env file is optional, ignored by systemd if not exists.
+func environmentFilePath(envFile string) (path string, optional bool) {
+	path = strings.TrimPrefix(envFile, "-")
+	return path, path != envFile
+}
+
+// Check env file at `path` needs to be generated or updated.
+// Optional env file is not generated if not exists.
+// Fails with `ErrUnitEnvFileNotManaged` if file not generated by systemd-cd.
+func (s Systemd) envFileChanged(env map[string]string, path string, optional bool) (bool, error) {
+	loaded, isGeneratedBySystemdCd, err := s.loadEnvFile(path)
+	if errors.Is(err, ErrNoSuchFileOrDir) {
+		// env file not exists
+		return !optional, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !isGeneratedBySystemdCd {
+		// env file already exists and file not generated by systemd-cd
+		return false, ErrUnitEnvFileNotManaged
+	}
+	return !reflect.DeepEqual(env, loaded), nil
+}
+
+// Disable and delete `.service` file.
+// Targets generated by `NewTarget()` are deleted once no services reference them.
 func (s Systemd) DeleteService(u UnitService) error {
+	// Disable before deleting `.service` file,
+	// `systemctl disable` reads [Install] section to remove symlinks (includes `Alias=`)
 	err := u.Disable(true)
 	if err != nil {
 		return err
@@ -121,8 +299,18 @@ func (s Systemd) DeleteService(u UnitService) error {
 
 	// Delete `.service` file
 	err = os.Remove(u.Path)
+	if err != nil {
+		return wrapNotExist(err, "delete unit file", u.Path)
+	}
 
-	return err
+	// Delete targets grouped the service
+	err = s.removeUnreferencedTargets(u.unitFile)
+	if err != nil {
+		return err
+	}
+
+	// daemon-reload
+	return s.daemonReload()
 }
 
 func (s Systemd) loadUnitFileSerivce(path string) (u UnitFileService, isGeneratedBySystemdCd bool, err error) {
@@ -130,11 +318,12 @@ func (s Systemd) loadUnitFileSerivce(path string) (u UnitFileService, isGenerate
 	b := &bytes.Buffer{}
 	err = readFile(path, b)
 	if err != nil {
+		err = wrapNotExist(err, "read unit file", path)
 		return
 	}
 
 	// Check generator
-	if strings.Contains(b.String(), "#! Generated by systemd-cd\n") {
+	if strings.Contains(normalizeLines(b.String()), annotation) {
 		isGeneratedBySystemdCd = true
 	}
 
@@ -144,21 +333,66 @@ func (s Systemd) loadUnitFileSerivce(path string) (u UnitFileService, isGenerate
 	return
 }
 
-func (s Systemd) writeUnitFileService(u UnitFileService, path string) error {
+func (s Systemd) writeUnitFileService(u UnitFileService, t *template.Template, path string) error {
+	return s.writeUnitFileServiceAs(u, t, path, filepath.Base(path))
+}
+
+// Write unit file to `path`, verified as `fileName` (e.g. `app.service`).
+// `path` may differ from unit file name when staging.
+func (s Systemd) writeUnitFileServiceAs(u UnitFileService, t *template.Template, path string, fileName string) error {
 	// Marshal
 	b := &bytes.Buffer{}
 	// Add annotation to distinct generator
-	b.WriteString("#! Generated by systemd-cd\n")
-	if b2, err := MarshalUnitFile(u); err != nil {
-		return err
+	b.WriteString(annotation)
+	var b2 []byte
+	var err error
+	if t != nil {
+		b2, err = ExecuteUnitFileTemplate(t, u)
 	} else {
-		b.Write(b2)
+		b2, err = MarshalUnitFile(u)
+	}
+	if err != nil {
+		return err
+	}
+	b.Write(b2)
+
+	if requiresVerify(u) {
+		err = s.verifyUnitFile(b.Bytes(), fileName)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Write to file
-	err := writeFile(path, b.Bytes())
+	err = writeFile(path, b.Bytes(), s.option.Umask)
 
-	return err
+	return wrapNotExist(err, "write unit file", path)
+}
+
+// Directives breaking service if misconfigured (e.g. dropping required capability)
+func requiresVerify(u UnitFileService) bool {
+	return len(u.Service.CapabilityBoundingSet) != 0 || len(u.Service.AmbientCapabilities) != 0
+}
+
+// Verify unit file content before replacing existing file.
+// `systemd-analyze verify` requires file name with unit type suffix.
+func (s Systemd) verifyUnitFile(b []byte, fileName string) error {
+	dir, err := os.MkdirTemp("", "systemd-cd-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, fileName)
+	err = writeFile(path, b, s.option.Umask)
+	if err != nil {
+		return err
+	}
+	err = s.systemctl.Verify(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnitVerifyFailed, err)
+	}
+	return nil
 }
 
 func (s Systemd) loadEnvFile(path string) (e map[string]string, isGeneratedBySystemdCd bool, err error) {
@@ -166,11 +400,12 @@ func (s Systemd) loadEnvFile(path string) (e map[string]string, isGeneratedBySys
 	b := &bytes.Buffer{}
 	err = readFile(path, b)
 	if err != nil {
+		err = wrapNotExist(err, "read env file", path)
 		return
 	}
 
 	// Check generator
-	if strings.Contains(b.String(), "#! Generated by systemd-cd\n") {
+	if strings.Contains(b.String(), annotation) {
 		isGeneratedBySystemdCd = true
 	}
 
@@ -187,7 +422,7 @@ func (s Systemd) writeEnvFile(e map[string]string, path string) error {
 	// Encode
 	b := &bytes.Buffer{}
 	// Add annotation
-	b.WriteString("#! Generated by systemd-cd\n")
+	b.WriteString(annotation)
 	indent := ""
 	err := toml.Encode(b, e, toml.EncodeOption{Indent: &indent})
 	if err != nil {
@@ -195,7 +430,7 @@ func (s Systemd) writeEnvFile(e map[string]string, path string) error {
 	}
 
 	// Write to file
-	err = writeFile(path, b.Bytes())
+	err = writeFile(path, b.Bytes(), s.option.Umask)
 
-	return err
+	return wrapNotExist(err, "write env file", path)
 }
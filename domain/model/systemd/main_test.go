@@ -0,0 +1,723 @@
+package systemd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestSystemd_NewService(t *testing.T) {
+	sigInt := "SIGINT"
+	user := "app"
+	group := "app"
+
+	tests := []struct {
+		name string
+		uf   UnitFileService
+		want []string
+	}{
+		{
+			name: "conflicts",
+			uf: UnitFileService{
+				Unit:    UnitDirective{Description: "app", Conflicts: []string{"app-legacy.service", "app-canary.service"}},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+				Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+			},
+			want: []string{"Conflicts=app-legacy.service app-canary.service\n"},
+		},
+		{
+			name: "restart kill signal",
+			uf: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:         ExecCommand{Command: "/usr/bin/app"},
+					RestartKillSignal: &sigInt,
+				},
+				Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+			},
+			want: []string{"RestartKillSignal=SIGINT\n"},
+		},
+		{
+			name: "supplementary groups",
+			uf: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:           ExecCommand{Command: "/usr/bin/app"},
+					User:                &user,
+					Group:               &group,
+					SupplementaryGroups: []string{"dialout", "video"},
+				},
+				Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+			},
+			want: []string{"User=app\n", "Group=app\n", "SupplementaryGroups=dialout video\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.NewService("app", tt.uf, nil)
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			got := &bytes.Buffer{}
+			err = readFile(dir+"app.service", got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got.String(), w) {
+					t.Errorf("unit file = %v, want contains %v", got.String(), w)
+				}
+			}
+			loaded, _, err := s.loadUnitFileSerivce(dir + "app.service")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !loaded.Equals(tt.uf) {
+				t.Errorf("loaded unit file = %v, want %v", loaded, tt.uf)
+			}
+
+			// Re-deploy same unit does not rewrite unit file
+			f, err := os.OpenFile(dir+"app.service", os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.WriteString("# marker\n")
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.NewService("app", tt.uf, nil)
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			got.Reset()
+			err = readFile(dir+"app.service", got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got.String(), "# marker\n") {
+				t.Errorf("unit file rewritten without changes")
+			}
+		})
+	}
+}
+
+func TestSystemd_NewService_whitespaceOnlyChanges(t *testing.T) {
+	uf := UnitFileService{
+		Unit:    UnitDirective{Description: "app"},
+		Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+		Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+	}
+	tmpl := template.Must(template.New("app").Parse(`[Unit]
+Description={{ .Unit.Description }}
+
+[Service]
+ExecStart={{ .Service.ExecStart }}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+	tests := []struct {
+		name string
+		t    *template.Template
+	}{
+		{name: "marshaled", t: nil},
+		{name: "template", t: tmpl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.t != nil {
+				_, err = s.NewServiceFromTemplate("app", tt.t, uf, nil)
+			} else {
+				_, err = s.NewService("app", uf, nil)
+			}
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+
+			// Convert to CRLF with trailing whitespaces
+			b := &bytes.Buffer{}
+			err = readFile(dir+"app.service", b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			edited := strings.ReplaceAll(b.String(), "\n", " \r\n")
+			err = os.WriteFile(dir+"app.service", []byte(edited), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var u UnitService
+			if tt.t != nil {
+				u, err = s.NewServiceFromTemplate("app", tt.t, uf, nil)
+			} else {
+				u, err = s.NewService("app", uf, nil)
+			}
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			if u.UnitFileChanged {
+				t.Errorf("UnitFileChanged = true, want false")
+			}
+			b.Reset()
+			err = readFile(dir+"app.service", b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != edited {
+				t.Errorf("unit file rewritten with whitespace only changes")
+			}
+		})
+	}
+}
+
+func TestSystemd_NewService_verify(t *testing.T) {
+	errVerify := errors.New("Unknown capability")
+
+	tests := []struct {
+		name       string
+		uf         UnitFileService
+		verifyErr  error
+		wantVerify bool
+		wantErr    error
+	}{
+		{
+			name: "without capabilities",
+			uf: UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			verifyErr:  errVerify,
+			wantVerify: false,
+			wantErr:    nil,
+		},
+		{
+			name: "capabilities verified",
+			uf: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:             ExecCommand{Command: "/usr/bin/app"},
+					CapabilityBoundingSet: []string{"CAP_NET_BIND_SERVICE"},
+				},
+			},
+			verifyErr:  nil,
+			wantVerify: true,
+			wantErr:    nil,
+		},
+		{
+			name: "verify failed",
+			uf: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:           ExecCommand{Command: "/usr/bin/app"},
+					AmbientCapabilities: []string{"CAP_UNKNOWN"},
+				},
+			},
+			verifyErr:  errVerify,
+			wantVerify: true,
+			wantErr:    ErrUnitVerifyFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			sc.verifyErr = tt.verifyErr
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.NewService("app", tt.uf, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			verified := false
+			for _, c := range sc.calls {
+				if c == "verify app.service" {
+					verified = true
+				}
+			}
+			if verified != tt.wantVerify {
+				t.Errorf("verified = %v, want %v (calls %v)", verified, tt.wantVerify, sc.calls)
+			}
+
+			_, err = os.Stat(dir + "app.service")
+			if exists := err == nil; exists != (tt.wantErr == nil) {
+				t.Errorf("unit file exists = %v, want %v", exists, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestSystemd_NewServiceFromTemplate(t *testing.T) {
+	uf := UnitFileService{
+		Unit:    UnitDirective{Description: "app"},
+		Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+		Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  error
+	}{
+		{
+			name: "custom template",
+			template: `[Unit]
+Description={{ .Unit.Description }} (custom)
+
+[Service]
+ExecStart={{ .Service.ExecStart }}
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`,
+			want: annotation + `[Unit]
+Description=app (custom)
+
+[Service]
+ExecStart=/usr/bin/app
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`,
+			wantErr: nil,
+		},
+		{
+			name: "validation runs on rendered output",
+			template: `[Unit]
+Description={{ .Unit.Description }}
+
+[Service]
+Type=oneshot
+`,
+			wantErr: ErrExecStartRequired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmpl := template.Must(template.New("unit").Parse(tt.template))
+
+			_, err = s.NewServiceFromTemplate("app", tmpl, uf, nil)
+			if err != tt.wantErr {
+				t.Fatalf("NewServiceFromTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got := &bytes.Buffer{}
+			err = readFile(dir+"app.service", got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("unit file = %v, want %v", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemd_NewService_umask(t *testing.T) {
+	umask0077 := os.FileMode(0077)
+	umask0022 := os.FileMode(0022)
+
+	tests := []struct {
+		name     string
+		umask    *os.FileMode
+		wantMode os.FileMode
+	}{
+		{name: "0077", umask: &umask0077, wantMode: 0600},
+		{name: "0022", umask: &umask0022, wantMode: 0644},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{Umask: tt.umask})
+			if err != nil {
+				t.Fatal(err)
+			}
+			envFile := dir + "app.env"
+			uf := UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{EnvironmentFile: &envFile, ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			}
+
+			_, err = s.NewService("app", uf, map[string]string{"TOKEN": "secret"})
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			for _, path := range []string{dir + "app.service", envFile} {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != tt.wantMode {
+					t.Errorf("mode of %v = %v, want %v", path, info.Mode().Perm(), tt.wantMode)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemd_NewService_environmentFileDir(t *testing.T) {
+	tests := []struct {
+		name string
+		// `EnvironmentFile=` relative to temp dir (empty: not specified)
+		envFile string
+		// env file path relative to temp dir
+		wantEnvFile string
+	}{
+		{name: "default placement", envFile: "", wantEnvFile: "env/app.env"},
+		{name: "explicit path", envFile: "default/app", wantEnvFile: "default/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			err := os.Mkdir(dir+"default", 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{EnvironmentFileDir: dir + "env"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			uf := UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			}
+			if tt.envFile != "" {
+				envFile := dir + tt.envFile
+				uf.Service.EnvironmentFile = &envFile
+			}
+
+			u, err := s.NewService("app", uf, map[string]string{"PORT": "8080"})
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			if _, err = os.Stat(dir + tt.wantEnvFile); err != nil {
+				t.Errorf("env file not generated: %v", err)
+			}
+			got := &bytes.Buffer{}
+			err = readFile(u.Path, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w := "EnvironmentFile=" + dir + tt.wantEnvFile + "\n"; !strings.Contains(got.String(), w) {
+				t.Errorf("unit file = %v, want contains %v", got.String(), w)
+			}
+		})
+	}
+}
+
+func TestSystemd_NewService_environmentFileParentDir(t *testing.T) {
+	umask0077 := os.FileMode(0077)
+
+	tests := []struct {
+		name     string
+		optional bool
+		umask    *os.FileMode
+		// env file and parent dir are created
+		wantCreated bool
+		wantDirMode os.FileMode
+	}{
+		{name: "managed", optional: false, umask: nil, wantCreated: true, wantDirMode: 0755},
+		{name: "managed with umask", optional: false, umask: &umask0077, wantCreated: true, wantDirMode: 0700},
+		{name: "optional", optional: true, umask: nil, wantCreated: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{Umask: tt.umask})
+			if err != nil {
+				t.Fatal(err)
+			}
+			envPath := dir + "missing/default/app"
+			envFile := envPath
+			if tt.optional {
+				envFile = "-" + envPath
+			}
+			uf := UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{EnvironmentFile: &envFile, ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			}
+
+			u, err := s.NewService("app", uf, map[string]string{"PORT": "8080"})
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			if u.EnvironmentFileChanged != tt.wantCreated {
+				t.Errorf("EnvironmentFileChanged = %v, want %v", u.EnvironmentFileChanged, tt.wantCreated)
+			}
+			_, err = os.Stat(envPath)
+			if created := err == nil; created != tt.wantCreated {
+				t.Errorf("env file created = %v, want %v", created, tt.wantCreated)
+			}
+			info, err := os.Stat(dir + "missing")
+			if created := err == nil; created != tt.wantCreated {
+				t.Fatalf("parent dir created = %v, want %v", created, tt.wantCreated)
+			}
+			if tt.wantCreated && info.Mode().Perm() != tt.wantDirMode {
+				t.Errorf("mode of parent dir = %v, want %v", info.Mode().Perm(), tt.wantDirMode)
+			}
+		})
+	}
+}
+
+func TestSystemd_errNoSuchFileOrDir(t *testing.T) {
+	dir := t.TempDir() + "/"
+	sc := newFakeSystemctl(dir)
+	s, err := New(sc, dir, Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		f       func() error
+		wantMsg string
+	}{
+		{
+			name: "read env file",
+			f: func() error {
+				_, _, err := s.loadEnvFile(dir + "missing.env")
+				return err
+			},
+			wantMsg: "no such file or directory: read env file: " + dir + "missing.env",
+		},
+		{
+			name: "read unit file",
+			f: func() error {
+				_, _, err := s.loadUnitFileSerivce(dir + "missing.service")
+				return err
+			},
+			wantMsg: "no such file or directory: read unit file: " + dir + "missing.service",
+		},
+		{
+			name: "delete unit file",
+			f: func() error {
+				return s.DeleteService(UnitService{systemctl: sc, Name: "missing", Path: dir + "missing.service"})
+			},
+			wantMsg: "no such file or directory: delete unit file: " + dir + "missing.service",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f()
+			if !errors.Is(err, ErrNoSuchFileOrDir) {
+				t.Fatalf("error = %v, want %v", err, ErrNoSuchFileOrDir)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("error = %v, want %v", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestSystemd_NoReload(t *testing.T) {
+	dir := t.TempDir() + "/"
+	sc := newFakeSystemctl(dir)
+	s, err := New(sc, dir, Option{NoReload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ReloadPending() {
+		t.Errorf("ReloadPending() = true before deploy, want false")
+	}
+
+	for _, name := range []string{"app-web", "app-worker"} {
+		_, err = s.NewService(name, UnitFileService{
+			Unit:    UnitDirective{Description: name},
+			Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/" + name}},
+		}, nil)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+	}
+	if len(sc.calls) != 0 {
+		t.Errorf("systemctl calls = %v, want empty", sc.calls)
+	}
+	if !s.ReloadPending() {
+		t.Errorf("ReloadPending() = false after deploy, want true")
+	}
+
+	err = s.DaemonReload()
+	if err != nil {
+		t.Fatalf("DaemonReload() error = %v", err)
+	}
+	if len(sc.calls) != 1 || sc.calls[0] != "daemon-reload" {
+		t.Errorf("systemctl calls = %v, want [daemon-reload]", sc.calls)
+	}
+	if s.ReloadPending() {
+		t.Errorf("ReloadPending() = true after DaemonReload(), want false")
+	}
+	// unchanged redeploy does not require daemon-reload
+	for _, name := range []string{"app-web", "app-worker"} {
+		_, err = s.NewService(name, UnitFileService{
+			Unit:    UnitDirective{Description: name},
+			Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/" + name}},
+		}, nil)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+	}
+	if s.ReloadPending() {
+		t.Errorf("ReloadPending() = true after unchanged redeploy, want false")
+	}
+	_, err = s.NewTarget("app", UnitFileTarget{Unit: UnitDirective{Description: "app"}})
+	if err != nil {
+		t.Fatalf("NewTarget() error = %v", err)
+	}
+	err = s.DaemonReload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.NewTarget("app", UnitFileTarget{Unit: UnitDirective{Description: "app"}})
+	if err != nil {
+		t.Fatalf("NewTarget() error = %v", err)
+	}
+	if s.ReloadPending() {
+		t.Errorf("ReloadPending() = true after unchanged redeploy, want false")
+	}
+}
+
+func TestSystemd_NoReload_ApplyChanges(t *testing.T) {
+	dir := t.TempDir() + "/"
+	sc := newFakeSystemctl(dir)
+	s, err := New(sc, dir, Option{NoReload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := []UnitService{}
+	for _, name := range []string{"app-web", "app-worker"} {
+		u, err := s.NewService(name, UnitFileService{
+			Unit:    UnitDirective{Description: name},
+			Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/" + name}},
+		}, nil)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		services = append(services, u)
+	}
+
+	// pending daemon-reload runs once before restarting changed unit
+	for _, u := range services {
+		_, err = u.ApplyChanges(false)
+		if err != nil {
+			t.Fatalf("ApplyChanges() error = %v", err)
+		}
+	}
+	want := []string{"daemon-reload", "restart app-web", "restart app-worker"}
+	if !reflect.DeepEqual(sc.calls, want) {
+		t.Errorf("systemctl calls = %v, want %v", sc.calls, want)
+	}
+	if s.ReloadPending() {
+		t.Errorf("ReloadPending() = true after ApplyChanges(), want false")
+	}
+}
+
+func TestSystemd_NewService_resolveExecPath(t *testing.T) {
+	binDir := t.TempDir()
+	err := os.WriteFile(binDir+"/app", []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		o           Option
+		command     string
+		wantCommand string
+		wantErr     error
+	}{
+		{
+			name:    "relative rejected without option",
+			o:       Option{},
+			command: "app --port 8080",
+			wantErr: ErrExecStartNotAbsolute,
+		},
+		{
+			name:        "resolved",
+			o:           Option{ResolveExecPath: true, ExecPath: "/nonexistent:" + binDir},
+			command:     "app --port 8080",
+			wantCommand: binDir + "/app --port 8080",
+			wantErr:     nil,
+		},
+		{
+			name:        "absolute kept",
+			o:           Option{ResolveExecPath: true, ExecPath: binDir},
+			command:     "/usr/bin/app",
+			wantCommand: "/usr/bin/app",
+			wantErr:     nil,
+		},
+		{
+			name:    "not found",
+			o:       Option{ResolveExecPath: true, ExecPath: binDir},
+			command: "missing",
+			wantErr: ErrExecPathNotResolved,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			s, err := New(newFakeSystemctl(dir), dir, tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.NewService("app", UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: tt.command}},
+			}, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if _, err := os.Stat(dir + "app.service"); !os.IsNotExist(err) {
+					t.Errorf("unit file generated on error")
+				}
+				return
+			}
+			loaded, _, err := s.loadUnitFileSerivce(dir + "app.service")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Service.ExecStart.Command != tt.wantCommand {
+				t.Errorf("ExecStart = %v, want %v", loaded.Service.ExecStart.Command, tt.wantCommand)
+			}
+		})
+	}
+}
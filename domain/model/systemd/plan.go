@@ -0,0 +1,255 @@
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrPlanDuplicatePath = errors.New("multiple units resolve to same file")
+
+const (
+	// Suffix of files staged by `Prepare()`, ignored by systemd
+	stagedSuffix = ".systemd-cd-staged"
+	// Suffix of live files kept until `Commit()` completes
+	backupSuffix = ".systemd-cd-backup"
+)
+
+type (
+	DesiredUnit struct {
+		Name     string
+		UnitFile UnitFileService
+		Env      map[string]string
+	}
+
+	// Staged changes of units, applied by `Commit()`.
+	Plan struct {
+		// Units with `UnitFileChanged` and `EnvironmentFileChanged`
+		Services []UnitService
+		files    []stagedFile
+		// Directories created by `Prepare()`, removed on discard
+		dirs []string
+	}
+
+	stagedFile struct {
+		path     string
+		backedUp bool
+	}
+)
+
+// Validate and stage unit files and env files of `desired`,
+// live unit files and env files are not changed.
+// Fails with `ErrPlanDuplicatePath` if units resolve to same unit file or env file.
+// If any unit fails, all staged files and created directories are removed.
+func (s Systemd) Prepare(desired []DesiredUnit) (p Plan, err error) {
+	defer func() {
+		if err != nil {
+			p.discard()
+			p = Plan{}
+		}
+	}()
+
+	// target paths, staged files of other unit must not be overwritten
+	paths := map[string]string{}
+	claim := func(path string, name string) error {
+		if other, ok := paths[path]; ok {
+			return fmt.Errorf("%w: %s (%s, %s)", ErrPlanDuplicatePath, path, other, name)
+		}
+		paths[path] = name
+		return nil
+	}
+
+	for _, d := range desired {
+		uf := s.placeEnvironmentFile(d.Name, d.UnitFile, d.Env)
+		uf, err = s.resolveExecStart(uf)
+		if err != nil {
+			return
+		}
+
+		// validate
+		err = validateUnitFileService(d.Name, uf, s.option)
+		if err != nil {
+			return
+		}
+		err = validateEnvironment(d.Env)
+		if err != nil {
+			return
+		}
+		err = s.checkPrincipals(uf)
+		if err != nil {
+			return
+		}
+
+		// stage `.service` file
+		path := strings.Join([]string{s.unitFileDir, d.Name, ".service"}, "")
+		err = claim(path, d.Name)
+		if err != nil {
+			return
+		}
+		var unitFileChanged bool
+		unitFileChanged, err = s.unitFileServiceChanged(uf, nil, nil, path)
+		if err != nil {
+			return
+		}
+		if unitFileChanged {
+			err = s.writeUnitFileServiceAs(uf, nil, path+stagedSuffix, filepath.Base(path))
+			if err != nil {
+				return
+			}
+			p.files = append(p.files, stagedFile{path: path})
+		}
+
+		// stage env file
+		envFileChanged := false
+		if uf.Service.EnvironmentFile != nil {
+			envPath, optional := environmentFilePath(*uf.Service.EnvironmentFile)
+			err = claim(envPath, d.Name)
+			if err != nil {
+				return
+			}
+			envFileChanged, err = s.envFileChanged(d.Env, envPath, optional)
+			if err != nil {
+				return
+			}
+			if envFileChanged {
+				err = p.mkdir(filepath.Dir(envPath), s.option.Umask)
+				if err != nil {
+					return
+				}
+				err = s.writeEnvFile(d.Env, envPath+stagedSuffix)
+				if err != nil {
+					return
+				}
+				p.files = append(p.files, stagedFile{path: envPath})
+			}
+		}
+
+		p.Services = append(p.Services, UnitService{
+			systemctl:              s.systemctl,
+			Name:                   d.Name,
+			unitFile:               uf,
+			Path:                   path,
+			EnvironmentFileValues:  d.Env,
+			UnitFileChanged:        unitFileChanged,
+			EnvironmentFileChanged: envFileChanged,
+			reload:                 s.reload,
+		})
+	}
+	return
+}
+
+// Replace live files by files staged in `p`, and daemon-reload once.
+// If any file or daemon-reload fails, all replaced files are rolled back.
+// Errors of rollback are wrapped with the error of commit.
+func (s Systemd) Commit(p Plan) error {
+	for i := range p.files {
+		err := p.files[i].swap()
+		if err != nil {
+			return p.rollback(i-1, err)
+		}
+	}
+
+	if len(p.files) == 0 {
+		// nothing changed
+		return nil
+	}
+
+	// daemon-reload
+	err := s.daemonReload()
+	if err != nil {
+		return p.rollback(len(p.files)-1, err)
+	}
+
+	// remove backups
+	for _, f := range p.files {
+		if f.backedUp {
+			os.Remove(f.path + backupSuffix)
+		}
+	}
+	return nil
+}
+
+// Restore files swapped until `p.files[last]` and discard staged changes.
+// Returns `err` wrapped with errors of files failed to restore.
+func (p Plan) rollback(last int, err error) error {
+	failed := []string{}
+	for i := last; i >= 0; i-- {
+		restoreErr := p.files[i].restore()
+		if restoreErr != nil {
+			failed = append(failed, restoreErr.Error())
+		}
+	}
+	p.discard()
+	if len(failed) != 0 {
+		return fmt.Errorf("%w: rollback failed: %s", err, strings.Join(failed, "; "))
+	}
+	return err
+}
+
+// Create directory with parents, created directories are recorded to be
+// removed on discard.
+func (p *Plan) mkdir(path string, umask *os.FileMode) error {
+	// find top directory to be created
+	top := ""
+	for d := filepath.Clean(path); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		top = d
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	err := mkdirIfNotExist(path, umask)
+	if err != nil {
+		return err
+	}
+	if top != "" {
+		p.dirs = append(p.dirs, top)
+	}
+	return nil
+}
+
+// Remove staged files and directories created by `Prepare()`.
+func (p Plan) discard() {
+	for _, f := range p.files {
+		os.Remove(f.path + stagedSuffix)
+	}
+	for i := len(p.dirs) - 1; i >= 0; i-- {
+		os.RemoveAll(p.dirs[i])
+	}
+}
+
+// Replace live file by staged file, live file is kept as backup.
+func (f *stagedFile) swap() error {
+	err := os.Rename(f.path, f.path+backupSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f.backedUp = err == nil
+
+	err = os.Rename(f.path+stagedSuffix, f.path)
+	if err != nil {
+		err = wrapNotExist(err, "commit staged file", f.path+stagedSuffix)
+		restoreErr := f.restore()
+		if restoreErr != nil {
+			return fmt.Errorf("%w: rollback failed: %v", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Restore live file from backup, or remove file not existed before.
+func (f *stagedFile) restore() error {
+	if f.backedUp {
+		return os.Rename(f.path+backupSuffix, f.path)
+	}
+	err := os.Remove(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package systemd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSystemd_Prepare(t *testing.T) {
+	dir := t.TempDir() + "/"
+	sc := newFakeSystemctl(dir)
+	s, err := New(sc, dir, Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envFile := dir + "env/app-web/.env"
+	desired := []DesiredUnit{
+		{
+			Name: "app-web",
+			UnitFile: UnitFileService{
+				Unit:    UnitDirective{Description: "web"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/web"}, EnvironmentFile: &envFile},
+			},
+			Env: map[string]string{"PORT": "8080"},
+		},
+		{
+			Name: "app-worker",
+			UnitFile: UnitFileService{
+				Unit:    UnitDirective{Description: "worker"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "worker"}},
+			},
+		},
+	}
+	_, err = s.Prepare(desired)
+	if !errors.Is(err, ErrExecStartNotAbsolute) {
+		t.Fatalf("Prepare() error = %v, want %v", err, ErrExecStartNotAbsolute)
+	}
+
+	// system is untouched
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files after failed Prepare() = %v, want empty", entries)
+	}
+	if len(sc.calls) != 0 {
+		t.Errorf("systemctl calls = %v, want empty", sc.calls)
+	}
+}
+
+func TestSystemd_Prepare_duplicatePath(t *testing.T) {
+	envFile := "/var/lib/app/.env"
+	unitFile := func(envFile *string) UnitFileService {
+		return UnitFileService{
+			Unit:    UnitDirective{Description: "app"},
+			Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, EnvironmentFile: envFile},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		desired []DesiredUnit
+	}{
+		{
+			name: "same unit",
+			desired: []DesiredUnit{
+				{Name: "app", UnitFile: unitFile(nil)},
+				{Name: "app", UnitFile: unitFile(nil)},
+			},
+		},
+		{
+			name: "same env file",
+			desired: []DesiredUnit{
+				{Name: "app-web", UnitFile: unitFile(&envFile), Env: map[string]string{"PORT": "8080"}},
+				{Name: "app-worker", UnitFile: unitFile(&envFile), Env: map[string]string{"QUEUE": "jobs"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			envFile = dir + "env/.env"
+			s, err := New(newFakeSystemctl(dir), dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.Prepare(tt.desired)
+			if !errors.Is(err, ErrPlanDuplicatePath) {
+				t.Fatalf("Prepare() error = %v, want %v", err, ErrPlanDuplicatePath)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("files after failed Prepare() = %v, want empty", entries)
+			}
+		})
+	}
+}
+
+func TestSystemd_Prepare_verify(t *testing.T) {
+	dir := t.TempDir() + "/"
+	sc := newFakeSystemctl(dir)
+	s, err := New(sc, dir, Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Prepare([]DesiredUnit{{
+		Name: "cap",
+		UnitFile: UnitFileService{
+			Unit: UnitDirective{Description: "cap"},
+			Service: ServiceDirective{
+				ExecStart:             ExecCommand{Command: "/usr/bin/app"},
+				CapabilityBoundingSet: []string{"CAP_NET_BIND_SERVICE"},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	// staged file is verified by unit file name
+	if len(sc.calls) != 1 || sc.calls[0] != "verify cap.service" {
+		t.Errorf("systemctl calls = %v, want [verify cap.service]", sc.calls)
+	}
+}
+
+func TestSystemd_Commit(t *testing.T) {
+	errReload := errors.New("daemon-reload failed")
+	unitFile := func(description string) UnitFileService {
+		return UnitFileService{
+			Unit:    UnitDirective{Description: description},
+			Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+		}
+	}
+	readUnitFile := func(t *testing.T, path string) string {
+		b := &bytes.Buffer{}
+		err := readFile(path, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		// break staged file of unit before commit
+		breakStaged string
+		// break backup of unit before rollback
+		breakBackup     string
+		reloadErr       error
+		wantErr         error
+		wantRollbackErr bool
+		wantCalls       []string
+	}{
+		{name: "commit", wantErr: nil, wantCalls: []string{"daemon-reload"}},
+		{name: "rollback", breakStaged: "c", wantErr: ErrNoSuchFileOrDir, wantCalls: nil},
+		{name: "rollback on daemon-reload failure", reloadErr: errReload, wantErr: errReload, wantCalls: []string{"daemon-reload"}},
+		{name: "rollback failure", breakBackup: "a", reloadErr: errReload, wantErr: errReload, wantRollbackErr: true, wantCalls: []string{"daemon-reload"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// deploy `a` and `c`, `b` is new unit
+			for _, name := range []string{"a", "c"} {
+				_, err = s.NewService(name, unitFile("v1"), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			sc.calls = nil
+			sc.daemonReloadErr = tt.reloadErr
+			if tt.breakBackup != "" {
+				sc.onDaemonReload = func() {
+					os.Remove(dir + tt.breakBackup + ".service" + backupSuffix)
+				}
+			}
+
+			p, err := s.Prepare([]DesiredUnit{
+				{Name: "a", UnitFile: unitFile("v2")},
+				{Name: "b", UnitFile: unitFile("v2")},
+				{Name: "c", UnitFile: unitFile("v2")},
+			})
+			if err != nil {
+				t.Fatalf("Prepare() error = %v", err)
+			}
+			for _, name := range []string{"a", "c"} {
+				if got := readUnitFile(t, dir+name+".service"); !strings.Contains(got, "Description=v1\n") {
+					t.Errorf("%s.service changed by Prepare() = %v", name, got)
+				}
+			}
+			if _, err := os.Stat(dir + "b.service"); !os.IsNotExist(err) {
+				t.Errorf("b.service generated by Prepare()")
+			}
+			for _, u := range p.Services {
+				if !u.UnitFileChanged {
+					t.Errorf("%s UnitFileChanged = false, want true", u.Name)
+				}
+			}
+
+			if tt.breakStaged != "" {
+				err = os.Remove(dir + tt.breakStaged + ".service" + stagedSuffix)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = s.Commit(p)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Commit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotRollbackErr := err != nil && strings.Contains(err.Error(), "rollback failed"); gotRollbackErr != tt.wantRollbackErr {
+				t.Errorf("Commit() error = %v, want rollback error %v", err, tt.wantRollbackErr)
+			}
+
+			if tt.wantErr == nil {
+				for _, name := range []string{"a", "b", "c"} {
+					if got := readUnitFile(t, dir+name+".service"); !strings.Contains(got, "Description=v2\n") {
+						t.Errorf("%s.service = %v, want v2", name, got)
+					}
+				}
+			} else {
+				for _, name := range []string{"a", "c"} {
+					if name == tt.breakBackup {
+						continue
+					}
+					if got := readUnitFile(t, dir+name+".service"); !strings.Contains(got, "Description=v1\n") {
+						t.Errorf("%s.service not rolled back = %v", name, got)
+					}
+				}
+				if _, err := os.Stat(dir + "b.service"); !os.IsNotExist(err) {
+					t.Errorf("b.service not rolled back")
+				}
+			}
+			if !reflect.DeepEqual(sc.calls, tt.wantCalls) {
+				t.Errorf("systemctl calls = %v, want %v", sc.calls, tt.wantCalls)
+			}
+
+			// no staged files or backups remain
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if !strings.HasSuffix(e.Name(), ".service") {
+					t.Errorf("file remains after Commit() = %v", e.Name())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrGroupNotFound = errors.New("group not found")
+)
+
+// Lookup and create principals on host, replaced in tests
+var (
+	lookupUser = func(name string) error {
+		if _, err := strconv.Atoi(name); err == nil {
+			_, err = user.LookupId(name)
+			return err
+		}
+		_, err := user.Lookup(name)
+		return err
+	}
+	lookupGroup = func(name string) error {
+		if _, err := strconv.Atoi(name); err == nil {
+			_, err = user.LookupGroupId(name)
+			return err
+		}
+		_, err := user.LookupGroup(name)
+		return err
+	}
+	createSystemUser = func(name string) error {
+		out, err := exec.Command("useradd", "--system", "--user-group", "--no-create-home", "--shell", "/usr/sbin/nologin", name).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("useradd %s: %w: %s", name, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+)
+
+func isUnknownPrincipal(err error) bool {
+	switch err.(type) {
+	case user.UnknownUserError, user.UnknownUserIdError, user.UnknownGroupError, user.UnknownGroupIdError:
+		return true
+	}
+	return false
+}
+
+// Check `User=` and `Group=` exist on host before writing unit file.
+// Missing user is created as system user if `Option.CreateUser` is set.
+func (s Systemd) checkPrincipals(u UnitFileService) error {
+	if !s.option.CheckPrincipals {
+		return nil
+	}
+
+	// specifiers (e.g. `%i`) are resolved by systemd
+	if name := u.Service.User; name != nil && !strings.Contains(*name, "%") {
+		err := lookupUser(*name)
+		if err != nil && isUnknownPrincipal(err) && s.option.CreateUser {
+			err = createSystemUser(*name)
+			if err != nil {
+				return err
+			}
+			err = lookupUser(*name)
+		}
+		if err != nil {
+			if isUnknownPrincipal(err) {
+				return fmt.Errorf("%w: %q", ErrUserNotFound, *name)
+			}
+			return err
+		}
+	}
+
+	if name := u.Service.Group; name != nil && !strings.Contains(*name, "%") {
+		err := lookupGroup(*name)
+		if err != nil {
+			if isUnknownPrincipal(err) {
+				return fmt.Errorf("%w: %q", ErrGroupNotFound, *name)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package systemd
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestSystemd_checkPrincipals(t *testing.T) {
+	// stub host users/groups
+	users := map[string]bool{}
+	groups := map[string]bool{}
+	created := []string{}
+	lookupUserOrig, lookupGroupOrig, createSystemUserOrig := lookupUser, lookupGroup, createSystemUser
+	t.Cleanup(func() {
+		lookupUser, lookupGroup, createSystemUser = lookupUserOrig, lookupGroupOrig, createSystemUserOrig
+	})
+	lookupUser = func(name string) error {
+		if !users[name] {
+			return user.UnknownUserError(name)
+		}
+		return nil
+	}
+	lookupGroup = func(name string) error {
+		if !groups[name] {
+			return user.UnknownGroupError(name)
+		}
+		return nil
+	}
+	createSystemUser = func(name string) error {
+		created = append(created, name)
+		users[name] = true
+		groups[name] = true
+		return nil
+	}
+
+	app := "app"
+	missing := "missing"
+	specifier := "app-%i"
+
+	tests := []struct {
+		name        string
+		option      Option
+		user        *string
+		group       *string
+		existing    []string
+		wantErr     error
+		wantCreated []string
+	}{
+		{
+			name:   "check disabled",
+			option: Option{},
+			user:   &missing,
+			group:  &missing,
+		},
+		{
+			name:     "existing user and group",
+			option:   Option{CheckPrincipals: true},
+			user:     &app,
+			group:    &app,
+			existing: []string{"app"},
+		},
+		{
+			name:    "missing user",
+			option:  Option{CheckPrincipals: true},
+			user:    &missing,
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:     "missing group",
+			option:   Option{CheckPrincipals: true},
+			user:     &app,
+			group:    &missing,
+			existing: []string{"app"},
+			wantErr:  ErrGroupNotFound,
+		},
+		{
+			name:        "create missing user",
+			option:      Option{CheckPrincipals: true, CreateUser: true},
+			user:        &missing,
+			group:       &missing,
+			wantCreated: []string{"missing"},
+		},
+		{
+			name:   "specifier",
+			option: Option{CheckPrincipals: true},
+			user:   &specifier,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, groups, created = map[string]bool{}, map[string]bool{}, []string{}
+			for _, name := range tt.existing {
+				users[name] = true
+				groups[name] = true
+			}
+
+			s := Systemd{option: tt.option}
+			err := s.checkPrincipals(UnitFileService{
+				Service: ServiceDirective{User: tt.user, Group: tt.group},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkPrincipals() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(created) != len(tt.wantCreated) {
+				t.Errorf("created users = %v, want %v", created, tt.wantCreated)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package systemd
+
+import "sync"
+
+// Pending daemon-reload deferred by `Option.NoReload`.
+// Shared by copies of `Systemd`.
+type reloadState struct {
+	mu      sync.Mutex
+	pending bool
+}
+
+// Run daemon-reload after changing unit files,
+// or mark it pending if `Option.NoReload`.
+func (s Systemd) daemonReload() error {
+	if s.option.NoReload {
+		s.reload.mu.Lock()
+		s.reload.pending = true
+		s.reload.mu.Unlock()
+		return nil
+	}
+	return s.DaemonReload()
+}
+
+// Run daemon-reload and clear pending reload.
+func (s Systemd) DaemonReload() error {
+	s.reload.mu.Lock()
+	defer s.reload.mu.Unlock()
+	return s.reload.run(s.systemctl)
+}
+
+// Run daemon-reload only if pending, before restarting unit with changed unit file.
+func (r *reloadState) runIfPending(sc Systemctl) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pending {
+		return nil
+	}
+	return r.run(sc)
+}
+
+// Caller must hold `r.mu`.
+func (r *reloadState) run(sc Systemctl) error {
+	err := sc.DaemonReload()
+	if err != nil {
+		return err
+	}
+	r.pending = false
+	return nil
+}
+
+// Unit files changed without daemon-reload (`Option.NoReload`).
+func (s Systemd) ReloadPending() bool {
+	s.reload.mu.Lock()
+	defer s.reload.mu.Unlock()
+	return s.reload.pending
+}
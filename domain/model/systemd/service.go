@@ -1,11 +1,30 @@
 package systemd
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnitStopFailed    = errors.New("unit still active after SIGKILL")
+	ErrUnitRestartFailed = errors.New("failed to issue restart")
+	ErrUnitUnhealthy     = errors.New("unit restarted but not running")
+)
+
+// Interval to poll unit status while waiting stop.
+var stopPollInterval = time.Second
+
 type Unit interface {
 	Enable(startNow bool) error
 	Disable(stopNow bool) error
 	Start() error
 	Stop() error
+	StopWithEscalation(gracePeriod time.Duration) (escalated bool, err error)
 	Restart() error
+	RestartWithRetry(retries int, backoff time.Duration) (attempts int, err error)
+	Reload() error
 	GetStatus() (Status, error)
 }
 
@@ -18,6 +37,8 @@ const (
 	StatusStopped Status = "stopped"
 	StatusRunning Status = "running"
 	StatusFailed  Status = "failed"
+	// Process still alive while activating, deactivating or reloading
+	StatusTransitioning Status = "transitioning"
 )
 
 var (
@@ -33,7 +54,22 @@ type (
 		unitFile              UnitFileService
 		Path                  string
 		EnvironmentFileValues map[string]string
+		// Unit file is generated or updated by `NewService()`
+		UnitFileChanged bool
+		// Env file is generated or updated by `NewService()`
+		EnvironmentFileChanged bool
+		// Pending daemon-reload of `Systemd` (`Option.NoReload`)
+		reload *reloadState
 	}
+
+	// Action taken by `ApplyChanges()`
+	Action string
+)
+
+const (
+	ActionNone    Action = "none"
+	ActionReload  Action = "reload"
+	ActionRestart Action = "restart"
 )
 
 // +Unit
@@ -56,12 +92,150 @@ func (u UnitService) Stop() error {
 	return u.systemctl.Stop(u.Name)
 }
 
+// Stop unit, and send SIGKILL if unit has not stopped in `gracePeriod`.
+// e.g. process ignores `ExecStop=` or SIGTERM.
+// +Unit
+func (u UnitService) StopWithEscalation(gracePeriod time.Duration) (escalated bool, err error) {
+	// `systemctl stop` blocks until `TimeoutStopSec=`
+	err = u.systemctl.StopNoBlock(u.Name)
+	if err != nil {
+		return
+	}
+	stopped, err := u.waitStopped(gracePeriod)
+	if err != nil || stopped {
+		return
+	}
+
+	// Escalate
+	escalated = true
+	err = u.systemctl.Kill(u.Name, "SIGKILL")
+	if err != nil {
+		return
+	}
+	stopped, err = u.waitStopped(gracePeriod)
+	if err != nil {
+		return
+	}
+	if !stopped {
+		err = ErrUnitStopFailed
+	}
+	return
+}
+
+// Poll status until unit stopped or timeout.
+func (u UnitService) waitStopped(timeout time.Duration) (stopped bool, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var s Status
+		s, err = u.systemctl.Status(u.Name)
+		if err != nil {
+			return
+		}
+		if s != StatusRunning && s != StatusTransitioning {
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(stopPollInterval)
+	}
+}
+
 // +Unit
 func (u UnitService) Restart() error {
 	return u.systemctl.Restart(u.Name)
 }
 
+// Restart unit, and retry up to `retries` times on failure.
+// Wait `backoff` before first retry, doubled on each retry.
+// Returns number of restart attempts.
+// Error wraps `ErrUnitRestartFailed` if `systemctl restart` itself failed,
+// or `ErrUnitUnhealthy` if unit was restarted but not running.
+// +Unit
+func (u UnitService) RestartWithRetry(retries int, backoff time.Duration) (attempts int, err error) {
+	for {
+		attempts++
+		err = u.restartChecked()
+		if err == nil || attempts > retries {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (u UnitService) restartChecked() error {
+	err := u.systemctl.Restart(u.Name)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnitRestartFailed, err)
+	}
+	s, err := u.systemctl.Status(u.Name)
+	if err != nil {
+		return err
+	}
+	if s != StatusRunning {
+		return fmt.Errorf("%w: %s", ErrUnitUnhealthy, s)
+	}
+	return nil
+}
+
+// +Unit
+func (u UnitService) Reload() error {
+	return u.systemctl.Reload(u.Name)
+}
+
+// Apply changes of unit file and env file generated by `NewService()`.
+// If `preferReload` and only env file changed, reload instead of restart.
+// Reload requires `ExecReload=`.
+func (u UnitService) ApplyChanges(preferReload bool) (Action, error) {
+	if u.UnitFileChanged {
+		// daemon-reload has done by `NewService()` unless deferred by `Option.NoReload`
+		err := u.reload.runIfPending(u.systemctl)
+		if err != nil {
+			return ActionNone, err
+		}
+		return ActionRestart, u.Restart()
+	}
+	if u.EnvironmentFileChanged {
+		if preferReload && len(u.unitFile.Service.ExecReload) != 0 {
+			return ActionReload, u.Reload()
+		}
+		return ActionRestart, u.Restart()
+	}
+	return ActionNone, nil
+}
+
 // +Unit
 func (u UnitService) GetStatus() (Status, error) {
 	return u.systemctl.Status(u.Name)
 }
+
+// Names of unit configured by `Alias=`.
+// Symlinks of aliases are created on `Enable()` and removed on `Disable()`.
+func (u UnitService) Aliases() []string {
+	return u.unitFile.Install.Alias
+}
+
+// Companion units configured by `Also=`.
+// Enabled on `Enable()` and disabled on `Disable()` together.
+func (u UnitService) Also() []string {
+	return u.unitFile.Install.Also
+}
+
+// Environment variables applied to unit.
+// `Environment=` takes precedence over `EnvironmentFile=` (same as systemd).
+// Keys defined in both with different values are returned as `conflicts`.
+func (u UnitService) EffectiveEnvironment() (env map[string]string, conflicts []string) {
+	env = map[string]string{}
+	for k, v := range u.EnvironmentFileValues {
+		env[k] = v
+	}
+	for k, v := range u.unitFile.Service.Environment {
+		if fv, ok := env[k]; ok && fv != v {
+			conflicts = append(conflicts, k)
+		}
+		env[k] = v
+	}
+	sort.Strings(conflicts)
+	return
+}
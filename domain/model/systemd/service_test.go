@@ -0,0 +1,463 @@
+package systemd
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnitService_EnableAlias(t *testing.T) {
+	tests := []struct {
+		name      string
+		alias     []string
+		wantLinks map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "no alias",
+			alias:     nil,
+			wantLinks: map[string]string{"app.service": "app"},
+			wantErr:   false,
+		},
+		{
+			name:  "aliases",
+			alias: []string{"web.service", "frontend.service"},
+			wantLinks: map[string]string{
+				"app.service":      "app",
+				"web.service":      "app",
+				"frontend.service": "app",
+			},
+			wantErr: false,
+		},
+		{
+			name:      "invalid suffix",
+			alias:     []string{"web.socket"},
+			wantLinks: map[string]string{},
+			wantErr:   true,
+		},
+		{
+			name:      "same as unit name",
+			alias:     []string{"app.service"},
+			wantLinks: map[string]string{},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// `Also=` units are enabled with their own [Install] section
+			err = os.WriteFile(dir+"app.timer", []byte("[Timer]\nOnCalendar=daily\n\n[Install]\nWantedBy=timers.target\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uf := UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+				Install: InstallDirective{WantedBy: []string{"multi-user.target"}, Alias: tt.alias},
+			}
+			u, err := s.NewService("app", uf, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(u.Aliases(), tt.alias) {
+				t.Errorf("Aliases() = %v, want %v", u.Aliases(), tt.alias)
+			}
+
+			err = u.Enable(true)
+			if err != nil {
+				t.Fatalf("Enable() error = %v", err)
+			}
+			if !reflect.DeepEqual(sc.links, tt.wantLinks) {
+				t.Errorf("links after Enable() = %v, want %v", sc.links, tt.wantLinks)
+			}
+
+			err = s.DeleteService(u)
+			if err != nil {
+				t.Fatalf("DeleteService() error = %v", err)
+			}
+			if len(sc.links) != 0 {
+				t.Errorf("links after DeleteService() = %v, want empty", sc.links)
+			}
+		})
+	}
+}
+
+func TestUnitService_EnableAlso(t *testing.T) {
+	tests := []struct {
+		name      string
+		also      []string
+		wantLinks map[string]string
+		wantWants map[string][]string
+	}{
+		{
+			name:      "no companion",
+			also:      nil,
+			wantLinks: map[string]string{"app.service": "app"},
+			wantWants: map[string][]string{"multi-user.target": {"app"}},
+		},
+		{
+			name: "timer and socket",
+			also: []string{"app.timer", "app.socket"},
+			wantLinks: map[string]string{
+				"app.service": "app",
+				"app.timer":   "app.timer",
+				"app.socket":  "app.socket",
+			},
+			wantWants: map[string][]string{
+				"multi-user.target": {"app"},
+				"timers.target":     {"app.timer"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// `Also=` units are enabled with their own [Install] section
+			err = os.WriteFile(dir+"app.timer", []byte("[Timer]\nOnCalendar=daily\n\n[Install]\nWantedBy=timers.target\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uf := UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+				Install: InstallDirective{WantedBy: []string{"multi-user.target"}, Also: tt.also},
+			}
+			u, err := s.NewService("app", uf, nil)
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			if !reflect.DeepEqual(u.Also(), tt.also) {
+				t.Errorf("Also() = %v, want %v", u.Also(), tt.also)
+			}
+
+			sc.calls = nil
+			err = u.Enable(false)
+			if err != nil {
+				t.Fatalf("Enable() error = %v", err)
+			}
+			// `systemctl enable` resolves `Also=` itself
+			if !reflect.DeepEqual(sc.calls, []string{"enable app"}) {
+				t.Errorf("calls of Enable() = %v, want [enable app]", sc.calls)
+			}
+			if !reflect.DeepEqual(sc.links, tt.wantLinks) {
+				t.Errorf("links after Enable() = %v, want %v", sc.links, tt.wantLinks)
+			}
+			if !reflect.DeepEqual(sc.wants, tt.wantWants) {
+				t.Errorf("wants after Enable() = %v, want %v", sc.wants, tt.wantWants)
+			}
+
+			sc.calls = nil
+			err = u.Disable(false)
+			if err != nil {
+				t.Fatalf("Disable() error = %v", err)
+			}
+			if !reflect.DeepEqual(sc.calls, []string{"disable app"}) {
+				t.Errorf("calls of Disable() = %v, want [disable app]", sc.calls)
+			}
+			if len(sc.links) != 0 {
+				t.Errorf("links after Disable() = %v, want empty", sc.links)
+			}
+			for target, units := range sc.wants {
+				if len(units) != 0 {
+					t.Errorf("wants[%v] after Disable() = %v, want empty", target, units)
+				}
+			}
+
+			// Re-enable and delete
+			err = u.Enable(false)
+			if err != nil {
+				t.Fatalf("Enable() error = %v", err)
+			}
+			err = s.DeleteService(u)
+			if err != nil {
+				t.Fatalf("DeleteService() error = %v", err)
+			}
+			if len(sc.links) != 0 {
+				t.Errorf("links after DeleteService() = %v, want empty", sc.links)
+			}
+		})
+	}
+}
+
+func TestUnitService_StopWithEscalation(t *testing.T) {
+	interval := stopPollInterval
+	t.Cleanup(func() { stopPollInterval = interval })
+	stopPollInterval = time.Millisecond
+
+	tests := []struct {
+		name          string
+		ignoreStop    bool
+		ignoreKill    bool
+		wantEscalated bool
+		wantCalls     []string
+		wantErr       error
+	}{
+		{
+			name:          "graceful stop",
+			wantEscalated: false,
+			wantCalls:     []string{"stop --no-block app"},
+			wantErr:       nil,
+		},
+		{
+			name:          "escalate to SIGKILL",
+			ignoreStop:    true,
+			wantEscalated: true,
+			wantCalls:     []string{"stop --no-block app", "kill -s SIGKILL app"},
+			wantErr:       nil,
+		},
+		{
+			name:          "SIGKILL does not clear unit",
+			ignoreStop:    true,
+			ignoreKill:    true,
+			wantEscalated: true,
+			wantCalls:     []string{"stop --no-block app", "kill -s SIGKILL app"},
+			wantErr:       ErrUnitStopFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := newFakeSystemctl("")
+			sc.status["app"] = StatusRunning
+			sc.ignoreStop["app"] = tt.ignoreStop
+			sc.ignoreKill["app"] = tt.ignoreKill
+			u := UnitService{systemctl: sc, Name: "app"}
+
+			escalated, err := u.StopWithEscalation(10 * time.Millisecond)
+			if err != tt.wantErr {
+				t.Errorf("StopWithEscalation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if escalated != tt.wantEscalated {
+				t.Errorf("StopWithEscalation() escalated = %v, want %v", escalated, tt.wantEscalated)
+			}
+			if !reflect.DeepEqual(sc.calls, tt.wantCalls) {
+				t.Errorf("systemctl calls = %v, want %v", sc.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestUnitService_RestartWithRetry(t *testing.T) {
+	errJob := errors.New("Job for app.service failed.")
+
+	tests := []struct {
+		name         string
+		retries      int
+		restartErrs  []error
+		failRestarts int
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "first attempt",
+			retries:      3,
+			wantAttempts: 1,
+			wantErr:      nil,
+		},
+		{
+			name:         "transient restart failure",
+			retries:      3,
+			restartErrs:  []error{errJob, errJob},
+			wantAttempts: 3,
+			wantErr:      nil,
+		},
+		{
+			name:         "transient unhealthy",
+			retries:      3,
+			failRestarts: 1,
+			wantAttempts: 2,
+			wantErr:      nil,
+		},
+		{
+			name:         "persistent restart failure",
+			retries:      2,
+			restartErrs:  []error{errJob, errJob, errJob},
+			wantAttempts: 3,
+			wantErr:      ErrUnitRestartFailed,
+		},
+		{
+			name:         "persistent unhealthy",
+			retries:      2,
+			failRestarts: 3,
+			wantAttempts: 3,
+			wantErr:      ErrUnitUnhealthy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := newFakeSystemctl("")
+			sc.restartErrs["app"] = tt.restartErrs
+			sc.failRestarts["app"] = tt.failRestarts
+			u := UnitService{systemctl: sc, Name: "app"}
+
+			attempts, err := u.RestartWithRetry(tt.retries, time.Millisecond)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RestartWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("RestartWithRetry() attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestUnitService_EffectiveEnvironment(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileValues    map[string]string
+		inline        map[string]string
+		wantEnv       map[string]string
+		wantConflicts []string
+	}{
+		{
+			name:          "env file only",
+			fileValues:    map[string]string{"PORT": "8080"},
+			inline:        nil,
+			wantEnv:       map[string]string{"PORT": "8080"},
+			wantConflicts: nil,
+		},
+		{
+			name:          "inline wins",
+			fileValues:    map[string]string{"PORT": "8080", "HOST": "0.0.0.0"},
+			inline:        map[string]string{"PORT": "3000", "DEBUG": "1"},
+			wantEnv:       map[string]string{"PORT": "3000", "HOST": "0.0.0.0", "DEBUG": "1"},
+			wantConflicts: []string{"PORT"},
+		},
+		{
+			name:          "same value is not conflict",
+			fileValues:    map[string]string{"PORT": "8080"},
+			inline:        map[string]string{"PORT": "8080"},
+			wantEnv:       map[string]string{"PORT": "8080"},
+			wantConflicts: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := UnitService{
+				unitFile:              UnitFileService{Service: ServiceDirective{Environment: tt.inline}},
+				EnvironmentFileValues: tt.fileValues,
+			}
+			gotEnv, gotConflicts := u.EffectiveEnvironment()
+			if !reflect.DeepEqual(gotEnv, tt.wantEnv) {
+				t.Errorf("EffectiveEnvironment() env = %v, want %v", gotEnv, tt.wantEnv)
+			}
+			if !reflect.DeepEqual(gotConflicts, tt.wantConflicts) {
+				t.Errorf("EffectiveEnvironment() conflicts = %v, want %v", gotConflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestUnitService_ApplyChanges(t *testing.T) {
+	reload := ExecCommand{Command: "/bin/kill -HUP $MAINPID"}
+	base := UnitFileService{
+		Unit:    UnitDirective{Description: "app"},
+		Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, ExecReload: []ExecCommand{reload}},
+	}
+	changedUnit := base
+	changedUnit.Unit.Description = "app v2"
+	withoutReload := base
+	withoutReload.Service.ExecReload = nil
+
+	tests := []struct {
+		name         string
+		initial      UnitFileService
+		uf           UnitFileService
+		env          map[string]string
+		preferReload bool
+		want         Action
+		wantCalls    []string
+	}{
+		{
+			name:         "no changes",
+			initial:      base,
+			uf:           base,
+			env:          map[string]string{"PORT": "8080"},
+			preferReload: true,
+			want:         ActionNone,
+			wantCalls:    nil,
+		},
+		{
+			name:         "env only changed",
+			initial:      base,
+			uf:           base,
+			env:          map[string]string{"PORT": "3000"},
+			preferReload: true,
+			want:         ActionReload,
+			wantCalls:    []string{"reload app"},
+		},
+		{
+			name:         "env only changed, reload not preferred",
+			initial:      base,
+			uf:           base,
+			env:          map[string]string{"PORT": "3000"},
+			preferReload: false,
+			want:         ActionRestart,
+			wantCalls:    []string{"restart app"},
+		},
+		{
+			name:         "env only changed, no reload mechanism",
+			initial:      withoutReload,
+			uf:           withoutReload,
+			env:          map[string]string{"PORT": "3000"},
+			preferReload: true,
+			want:         ActionRestart,
+			wantCalls:    []string{"restart app"},
+		},
+		{
+			name:         "unit changed",
+			initial:      base,
+			uf:           changedUnit,
+			env:          map[string]string{"PORT": "3000"},
+			preferReload: true,
+			want:         ActionRestart,
+			wantCalls:    []string{"restart app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			sc := newFakeSystemctl(dir)
+			s, err := New(sc, dir, Option{EnvironmentFileDir: dir + "env"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.NewService("app", tt.initial, map[string]string{"PORT": "8080"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			u, err := s.NewService("app", tt.uf, tt.env)
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			sc.calls = nil
+			got, err := u.ApplyChanges(tt.preferReload)
+			if err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyChanges() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(sc.calls, tt.wantCalls) {
+				t.Errorf("systemctl calls = %v, want %v", sc.calls, tt.wantCalls)
+			}
+		})
+	}
+}
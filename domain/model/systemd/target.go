@@ -0,0 +1,312 @@
+package systemd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrUnitTargetReferenced = errors.New("target still referenced by service")
+)
+
+type (
+	// Unit file of `.target` to group services.
+	// Services join the group by `PartOf=` and `WantedBy=` the target.
+	UnitFileTarget struct {
+		Unit    UnitDirective
+		Install InstallDirective
+	}
+
+	unitFileTargetToml struct {
+		Unit    unitDirectiveToml
+		Install installDirectiveToml
+	}
+)
+
+// Compare unit files in the form written to file,
+// whitespace differences are ignored.
+func (c UnitFileTarget) Equals(d UnitFileTarget) bool {
+	return reflect.DeepEqual(c.normalized(), d.normalized())
+}
+
+// Unit file after round-trip of marshal/unmarshal.
+func (c UnitFileTarget) normalized() UnitFileTarget {
+	b, err := MarshalUnitFileTarget(c)
+	if err != nil {
+		return c
+	}
+	n, err := UnmarshalUnitFileTarget(bytes.NewBuffer(b))
+	if err != nil {
+		return c
+	}
+	return n
+}
+
+func MarshalUnitFileTarget(u UnitFileTarget) ([]byte, error) {
+	return encodeUnitFile(unitFileTargetToml{
+		Unit:    unitDirectiveToToml(u.Unit),
+		Install: installDirectiveToToml(u.Install),
+	})
+}
+
+func UnmarshalUnitFileTarget(b *bytes.Buffer) (u UnitFileTarget, err error) {
+	ut := &unitFileTargetToml{}
+	err = decodeUnitFile(b, ut)
+	if err != nil {
+		return
+	}
+	u = UnitFileTarget{
+		Unit:    unitDirectiveFromToml(ut.Unit),
+		Install: installDirectiveFromToml(ut.Install),
+	}
+	return
+}
+
+type UnitTarget struct {
+	systemctl Systemctl
+	Name      string
+	unitFile  UnitFileTarget
+	Path      string
+	// Unit file is generated or updated by `NewTarget()`
+	UnitFileChanged bool
+	// Pending daemon-reload of `Systemd` (`Option.NoReload`)
+	reload *reloadState
+}
+
+func (u UnitTarget) unitName() string {
+	return u.Name + ".target"
+}
+
+func (u UnitTarget) Enable(startNow bool) error {
+	return u.systemctl.Enable(u.unitName(), startNow)
+}
+
+func (u UnitTarget) Disable(stopNow bool) error {
+	return u.systemctl.Disable(u.unitName(), stopNow)
+}
+
+// Start target and services `WantedBy=` the target.
+func (u UnitTarget) Start() error {
+	err := u.reloadIfChanged()
+	if err != nil {
+		return err
+	}
+	return u.systemctl.Start(u.unitName())
+}
+
+// Stop target and services `PartOf=` the target.
+func (u UnitTarget) Stop() error {
+	return u.systemctl.Stop(u.unitName())
+}
+
+// Restart target and services `PartOf=` the target.
+func (u UnitTarget) Restart() error {
+	err := u.reloadIfChanged()
+	if err != nil {
+		return err
+	}
+	return u.systemctl.Restart(u.unitName())
+}
+
+// Run daemon-reload deferred by `Option.NoReload` before applying changed unit file.
+func (u UnitTarget) reloadIfChanged() error {
+	if !u.UnitFileChanged {
+		return nil
+	}
+	return u.reload.runIfPending(u.systemctl)
+}
+
+func (u UnitTarget) GetStatus() (Status, error) {
+	return u.systemctl.Status(u.unitName())
+}
+
+// Generate `.target` unit file.
+// If unit file already exists, replace it.
+func (s Systemd) NewTarget(name string, uf UnitFileTarget) (UnitTarget, error) {
+	// load unit file
+	path := strings.Join([]string{s.unitFileDir, name, ".target"}, "")
+	loaded, isGeneratedBySystemdCd, err := s.loadUnitFileTarget(path)
+	if err != nil && !errors.Is(err, ErrNoSuchFileOrDir) {
+		// fail
+		return UnitTarget{}, err
+	}
+
+	changed := false
+	if errors.Is(err, ErrNoSuchFileOrDir) {
+		// unit file not exists
+		changed = true
+		err = s.writeUnitFileTarget(uf, path)
+	} else if isGeneratedBySystemdCd {
+		// unit file already exists and file generated by systemd-cd
+		if !loaded.Equals(uf) {
+			changed = true
+			err = s.writeUnitFileTarget(uf, path)
+		}
+	} else {
+		// unit file already exists and file not generated by systemd-cd
+		err = ErrUnitFileNotManaged
+	}
+	if err != nil {
+		// fail
+		return UnitTarget{}, err
+	}
+
+	// daemon-reload
+	if changed {
+		err = s.daemonReload()
+	}
+
+	return UnitTarget{
+		systemctl:       s.systemctl,
+		Name:            name,
+		unitFile:        uf,
+		Path:            path,
+		UnitFileChanged: changed,
+		reload:          s.reload,
+	}, err
+}
+
+// Delete `.target` unit file.
+// Fails with `ErrUnitTargetReferenced` while services in unit file directory
+// reference the target by `PartOf=`, `WantedBy=` or `RequiredBy=`.
+func (s Systemd) DeleteTarget(u UnitTarget) error {
+	referenced, err := s.targetReferenced(u.unitName())
+	if err != nil {
+		return err
+	}
+	if referenced {
+		return ErrUnitTargetReferenced
+	}
+
+	err = s.removeTarget(u)
+	if err != nil {
+		return err
+	}
+
+	// daemon-reload
+	return s.daemonReload()
+}
+
+func (s Systemd) removeTarget(u UnitTarget) error {
+	err := u.Disable(true)
+	if err != nil {
+		return err
+	}
+
+	// Delete `.target` file
+	err = os.Remove(u.Path)
+	return wrapNotExist(err, "delete unit file", u.Path)
+}
+
+// Delete targets generated by systemd-cd and no longer referenced,
+// after service referencing them is deleted.
+func (s Systemd) removeUnreferencedTargets(uf UnitFileService) error {
+	for _, l := range [][]string{uf.Unit.PartOf, uf.Install.WantedBy, uf.Install.RequiredBy} {
+		for _, t := range l {
+			if !strings.HasSuffix(t, ".target") {
+				continue
+			}
+			path := s.unitFileDir + t
+			_, isGeneratedBySystemdCd, err := s.loadUnitFileTarget(path)
+			if errors.Is(err, ErrNoSuchFileOrDir) || (err == nil && !isGeneratedBySystemdCd) {
+				// system target (e.g. `multi-user.target`) or not managed
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			referenced, err := s.targetReferenced(t)
+			if err != nil {
+				return err
+			}
+			if referenced {
+				continue
+			}
+			err = s.removeTarget(UnitTarget{
+				systemctl: s.systemctl,
+				Name:      strings.TrimSuffix(t, ".target"),
+				Path:      path,
+				reload:    s.reload,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Directives referencing target
+var targetReferenceDirectives = map[string]bool{"PartOf": true, "WantedBy": true, "RequiredBy": true}
+
+// Check services in unit file directory reference `target`.
+// Directive lines are scanned without unmarshal,
+// services not managed by systemd-cd may not be parsed by `UnmarshalUnitFile()`.
+func (s Systemd) targetReferenced(target string) (bool, error) {
+	entries, err := os.ReadDir(s.unitFileDir)
+	if err != nil {
+		return false, wrapNotExist(err, "read unit file dir", s.unitFileDir)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".service") {
+			continue
+		}
+		b := &bytes.Buffer{}
+		err := readFile(s.unitFileDir+e.Name(), b)
+		if err != nil {
+			return false, wrapNotExist(err, "read unit file", s.unitFileDir+e.Name())
+		}
+		for _, l := range strings.Split(normalizeLines(b.String()), "\n") {
+			key, value, found := strings.Cut(l, "=")
+			if !found || !targetReferenceDirectives[strings.TrimSpace(key)] {
+				continue
+			}
+			for _, t := range strings.Fields(value) {
+				if t == target {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s Systemd) loadUnitFileTarget(path string) (u UnitFileTarget, isGeneratedBySystemdCd bool, err error) {
+	// Read file
+	b := &bytes.Buffer{}
+	err = readFile(path, b)
+	if err != nil {
+		err = wrapNotExist(err, "read unit file", path)
+		return
+	}
+
+	// Check generator
+	if strings.Contains(normalizeLines(b.String()), annotation) {
+		isGeneratedBySystemdCd = true
+	}
+
+	// Unmarshal
+	u, err = UnmarshalUnitFileTarget(b)
+
+	return
+}
+
+func (s Systemd) writeUnitFileTarget(u UnitFileTarget, path string) error {
+	// Marshal
+	b := &bytes.Buffer{}
+	// Add annotation to distinct generator
+	b.WriteString(annotation)
+	b2, err := MarshalUnitFileTarget(u)
+	if err != nil {
+		return err
+	}
+	b.Write(b2)
+
+	// Write to file
+	err = writeFile(path, b.Bytes(), s.option.Umask)
+
+	return wrapNotExist(err, "write unit file", path)
+}
@@ -0,0 +1,138 @@
+package systemd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalUnitFileTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		u    UnitFileTarget
+	}{
+		{
+			name: "round-trip",
+			u: UnitFileTarget{
+				Unit: UnitDirective{
+					Description: "app group",
+					Wants:       []string{"app-web.service", "app-worker.service"},
+				},
+				Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := MarshalUnitFileTarget(tt.u)
+			if err != nil {
+				t.Fatalf("MarshalUnitFileTarget() error = %v", err)
+			}
+			if strings.Contains(string(b), "[Service]") {
+				t.Errorf("MarshalUnitFileTarget() = %v, want without [Service]", string(b))
+			}
+			got, err := UnmarshalUnitFileTarget(bytes.NewBuffer(b))
+			if err != nil {
+				t.Fatalf("UnmarshalUnitFileTarget() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.u) {
+				t.Errorf("UnmarshalUnitFileTarget() = %v, want %v", got, tt.u)
+			}
+		})
+	}
+}
+
+func TestSystemd_NewTarget(t *testing.T) {
+	dir := t.TempDir() + "/"
+	sc := newFakeSystemctl(dir)
+	s, err := New(sc, dir, Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := s.NewTarget("app", UnitFileTarget{
+		Unit:    UnitDirective{Description: "app group"},
+		Install: InstallDirective{WantedBy: []string{"multi-user.target"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTarget() error = %v", err)
+	}
+	if !target.UnitFileChanged {
+		t.Errorf("UnitFileChanged = false, want true")
+	}
+	if target.Path != dir+"app.target" {
+		t.Errorf("Path = %v, want %v", target.Path, dir+"app.target")
+	}
+
+	// Group services by target
+	services := []UnitService{}
+	for _, name := range []string{"app-web", "app-worker"} {
+		u, err := s.NewService(name, UnitFileService{
+			Unit:    UnitDirective{Description: name, PartOf: []string{"app.target"}},
+			Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/" + name}},
+			Install: InstallDirective{WantedBy: []string{"app.target"}},
+		}, nil)
+		if err != nil {
+			t.Fatalf("NewService() error = %v", err)
+		}
+		err = u.Enable(false)
+		if err != nil {
+			t.Fatalf("Enable() error = %v", err)
+		}
+		services = append(services, u)
+	}
+
+	// Grouped start/stop
+	err = target.Start()
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	for _, u := range services {
+		if st, _ := u.GetStatus(); st != StatusRunning {
+			t.Errorf("%s status after Start() = %v, want %v", u.Name, st, StatusRunning)
+		}
+	}
+	err = target.Stop()
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	for _, u := range services {
+		if st, _ := u.GetStatus(); st != StatusStopped {
+			t.Errorf("%s status after Stop() = %v, want %v", u.Name, st, StatusStopped)
+		}
+	}
+
+	// Target is kept while referenced
+	err = s.DeleteTarget(target)
+	if !errors.Is(err, ErrUnitTargetReferenced) {
+		t.Errorf("DeleteTarget() error = %v, want %v", err, ErrUnitTargetReferenced)
+	}
+	if _, err := os.Stat(target.Path); err != nil {
+		t.Errorf("target deleted while referenced: %v", err)
+	}
+
+	// Services not managed by systemd-cd are scanned without unmarshal
+	err = os.WriteFile(dir+"foreign.service", []byte("[Service]\nType=oneshot\nExecStart=/bin/a\nExecStart=/bin/b\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Target is deleted automatically after last referencing service deleted
+	err = s.DeleteService(services[0])
+	if err != nil {
+		t.Fatalf("DeleteService() error = %v", err)
+	}
+	if _, err := os.Stat(target.Path); err != nil {
+		t.Errorf("target deleted while referenced: %v", err)
+	}
+	err = s.DeleteService(services[1])
+	if err != nil {
+		t.Fatalf("DeleteService() error = %v", err)
+	}
+	if _, err := os.Stat(target.Path); !os.IsNotExist(err) {
+		t.Errorf("target not deleted: %v", err)
+	}
+}
@@ -2,9 +2,13 @@ package systemd
 
 import (
 	"bytes"
+	"errors"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"systemd-cd/domain/model/toml"
+	"text/template"
 )
 
 type (
@@ -20,19 +24,69 @@ type (
 		After         []string
 		Requires      []string
 		Wants         []string
-		Conflicts     []string
+		// e.g. `app.target`, stopped/restarted together with listed units
+		PartOf    []string
+		Conflicts []string
+		// e.g. `none`, `reboot`, `poweroff`
+		// Values reboot/poweroff host requires `Option.AllowDangerousActions`.
+		StartLimitAction *string
+		// Comparison operator is kept as it is. e.g. `>=4G`
+		ConditionMemory []string
+		// Comparison operator is kept as it is. e.g. `>=2`
+		ConditionCPUs []string
+		// e.g. `/var`, `!/etc`
+		ConditionNeedsUpdate []string
+		// e.g. `cpu`, `memory io`
+		ConditionControlGroupController *string
 	}
 
 	UnitType string
 
 	ServiceDirective struct {
-		Type            *UnitType
+		Type *UnitType
+		// Env file generated by systemd-cd
 		EnvironmentFile *string
-		ExecStart       string
-		ExecStop        *string
-		ExecReload      *string
+		// Additional `EnvironmentFile=` not managed by systemd-cd,
+		// read before `EnvironmentFile`
+		ExtraEnvironmentFiles []string
+		// Inline `Environment=`, takes precedence over `EnvironmentFile=`
+		Environment  map[string]string
+		ExecStartPre []ExecCommand
+		ExecStart    ExecCommand
+		// Directories to search relative `Exec*=` executables (systemd 250+)
+		ExecSearchPath  []string
+		ExecStop        []ExecCommand
+		ExecReload      []ExecCommand
 		Restart         *string
 		RemainAfterExit *string
+		// Shorthand of both `TimeoutStartSec=` and `TimeoutStopSec=`,
+		// cannot be combined with them. e.g. `30s`, `infinity`
+		TimeoutSec      *string
+		TimeoutStartSec *string
+		TimeoutStopSec  *string
+		User            *string
+		Group           *string
+		// Non-empty group names, combined with `User=`
+		SupplementaryGroups []string
+		// e.g. `app.socket`
+		Sockets []string
+		// e.g. `CAP_NET_BIND_SERVICE`, `~CAP_SYS_ADMIN`
+		// Unit file is verified by `systemd-analyze verify` if set
+		CapabilityBoundingSet []string
+		// Unit file is verified by `systemd-analyze verify` if set
+		AmbientCapabilities []string
+		// Signal name or number. e.g. `SIGTERM`, `15`
+		RestartKillSignal *string
+		// Signal name or number. e.g. `SIGKILL`, `9`
+		FinalKillSignal *string
+		// 1-10000
+		CPUWeight *int
+		// 1-10000
+		IOWeight *int
+		// e.g. `512M`, `10%`, `infinity`
+		MemoryHigh *string
+		// e.g. `512M`, `10%`, `infinity`
+		MemoryLow *string
 	}
 
 	InstallDirective struct {
@@ -44,6 +98,14 @@ type (
 	}
 )
 
+var (
+	ErrExecStartRepeated = errors.New("repeated `ExecStart=` is not supported")
+)
+
+// Annotation marks `EnvironmentFile=` of env file generated by systemd-cd,
+// other `EnvironmentFile=` are kept as `ExtraEnvironmentFiles`.
+const managedEnvironmentFileAnnotation = "#! EnvironmentFile managed by systemd-cd"
+
 const (
 	UnitTypeSimple  UnitType = "simple"
 	UnitTypeForking UnitType = "forking"
@@ -53,8 +115,23 @@ const (
 	UnitTypeIdle    UnitType = "idle"
 )
 
+// Compare unit files in the form written to file,
+// whitespace differences are ignored.
 func (c UnitFileService) Equals(d UnitFileService) bool {
-	return reflect.DeepEqual(c, d)
+	return reflect.DeepEqual(c.normalized(), d.normalized())
+}
+
+// Unit file after round-trip of marshal/unmarshal.
+func (c UnitFileService) normalized() UnitFileService {
+	b, err := MarshalUnitFile(c)
+	if err != nil {
+		return c
+	}
+	n, err := UnmarshalUnitFile(bytes.NewBuffer(b))
+	if err != nil {
+		return c
+	}
+	return n
 }
 
 type (
@@ -65,22 +142,48 @@ type (
 	}
 
 	unitDirectiveToml struct {
-		Description   string  `toml:"Description"`
-		Documentation string  `toml:"Documentation"`
-		After         *string `toml:"After,omitempty"`
-		Requires      *string `toml:"Requires,omitempty"`
-		Wants         *string `toml:"Wants,omitempty"`
-		Conflicts     *string `toml:"Conflicts,omitempty"`
+		Description                     string   `toml:"Description"`
+		Documentation                   string   `toml:"Documentation"`
+		After                           *string  `toml:"After,omitempty"`
+		Requires                        *string  `toml:"Requires,omitempty"`
+		Wants                           *string  `toml:"Wants,omitempty"`
+		PartOf                          *string  `toml:"PartOf,omitempty"`
+		Conflicts                       *string  `toml:"Conflicts,omitempty"`
+		StartLimitAction                *string  `toml:"StartLimitAction,omitempty"`
+		ConditionMemory                 []string `toml:"ConditionMemory,omitempty"`
+		ConditionCPUs                   []string `toml:"ConditionCPUs,omitempty"`
+		ConditionNeedsUpdate            []string `toml:"ConditionNeedsUpdate,omitempty"`
+		ConditionControlGroupController *string  `toml:"ConditionControlGroupController,omitempty"`
 	}
 
 	serviceDirectiveToml struct {
 		Type            *UnitType `toml:"Type,omitempty"`
-		EnvironmentFile *string   `toml:"EnvironmentFile,omitempty"`
-		ExecStart       string    `toml:"ExecStart"`
-		ExecStop        *string   `toml:"ExecStop,omitempty"`
-		ExecReload      *string   `toml:"ExecReload,omitempty"`
-		Restart         *string   `toml:"Restart,omitempty"`
-		RemainAfterExit *string   `toml:"RemainAfterExit,omitempty"`
+		EnvironmentFile []string  `toml:"EnvironmentFile,omitempty"`
+		// Written as `EnvironmentFile=` after `managedEnvironmentFileAnnotation`
+		ManagedEnvironmentFile *string  `toml:"ManagedEnvironmentFile,omitempty"`
+		Environment            *string  `toml:"Environment,omitempty"`
+		ExecStartPre           []string `toml:"ExecStartPre,omitempty"`
+		ExecStart              string   `toml:"ExecStart"`
+		ExecSearchPath         *string  `toml:"ExecSearchPath,omitempty"`
+		ExecStop               []string `toml:"ExecStop,omitempty"`
+		ExecReload             []string `toml:"ExecReload,omitempty"`
+		Restart                *string  `toml:"Restart,omitempty"`
+		RemainAfterExit        *string  `toml:"RemainAfterExit,omitempty"`
+		TimeoutSec             *string  `toml:"TimeoutSec,omitempty"`
+		TimeoutStartSec        *string  `toml:"TimeoutStartSec,omitempty"`
+		TimeoutStopSec         *string  `toml:"TimeoutStopSec,omitempty"`
+		User                   *string  `toml:"User,omitempty"`
+		Group                  *string  `toml:"Group,omitempty"`
+		SupplementaryGroups    *string  `toml:"SupplementaryGroups,omitempty"`
+		Sockets                *string  `toml:"Sockets,omitempty"`
+		CapabilityBoundingSet  *string  `toml:"CapabilityBoundingSet,omitempty"`
+		AmbientCapabilities    *string  `toml:"AmbientCapabilities,omitempty"`
+		RestartKillSignal      *string  `toml:"RestartKillSignal,omitempty"`
+		FinalKillSignal        *string  `toml:"FinalKillSignal,omitempty"`
+		CPUWeight              *string  `toml:"CPUWeight,omitempty"`
+		IOWeight               *string  `toml:"IOWeight,omitempty"`
+		MemoryHigh             *string  `toml:"MemoryHigh,omitempty"`
+		MemoryLow              *string  `toml:"MemoryLow,omitempty"`
 	}
 
 	installDirectiveToml struct {
@@ -92,38 +195,64 @@ type (
 	}
 )
 
+// Start timeout applied by systemd, `TimeoutSec=` is used if `TimeoutStartSec=` not set.
+func (d ServiceDirective) EffectiveTimeoutStartSec() *string {
+	if d.TimeoutStartSec != nil {
+		return d.TimeoutStartSec
+	}
+	return d.TimeoutSec
+}
+
+// Stop timeout applied by systemd, `TimeoutSec=` is used if `TimeoutStopSec=` not set.
+func (d ServiceDirective) EffectiveTimeoutStopSec() *string {
+	if d.TimeoutStopSec != nil {
+		return d.TimeoutStopSec
+	}
+	return d.TimeoutSec
+}
+
 func MarshalUnitFile(u UnitFileService) ([]byte, error) {
 	ut := unitFileServiceToml{
-		Unit: unitDirectiveToml{
-			Description:   u.Unit.Description,
-			Documentation: u.Unit.Documentation,
-			After:         spacedString(u.Unit.After),
-			Requires:      spacedString(u.Unit.Requires),
-			Wants:         spacedString(u.Unit.Wants),
-			Conflicts:     spacedString(u.Unit.Conflicts),
-		},
+		Unit: unitDirectiveToToml(u.Unit),
 		Service: serviceDirectiveToml{
-			Type:            u.Service.Type,
-			EnvironmentFile: u.Service.EnvironmentFile,
-			ExecStart:       u.Service.ExecStart,
-			ExecStop:        u.Service.ExecStop,
-			ExecReload:      u.Service.ExecReload,
-			Restart:         u.Service.Restart,
-			RemainAfterExit: u.Service.RemainAfterExit,
-		},
-		Install: installDirectiveToml{
-			Alias:           spacedString(u.Install.Alias),
-			RequiredBy:      spacedString(u.Install.RequiredBy),
-			WantedBy:        spacedString(u.Install.WantedBy),
-			Also:            spacedString(u.Install.Also),
-			DefaultInstance: u.Install.DefaultInstance,
+			Type:                   u.Service.Type,
+			EnvironmentFile:        nonEmpty(u.Service.ExtraEnvironmentFiles),
+			ManagedEnvironmentFile: u.Service.EnvironmentFile,
+			Environment:            environmentString(u.Service.Environment),
+			ExecStartPre:           execCommandStrings(u.Service.ExecStartPre),
+			ExecStart:              u.Service.ExecStart.String(),
+			ExecSearchPath:         colonString(u.Service.ExecSearchPath),
+			ExecStop:               execCommandStrings(u.Service.ExecStop),
+			ExecReload:             execCommandStrings(u.Service.ExecReload),
+			Restart:                u.Service.Restart,
+			RemainAfterExit:        u.Service.RemainAfterExit,
+			TimeoutSec:             u.Service.TimeoutSec,
+			TimeoutStartSec:        u.Service.TimeoutStartSec,
+			TimeoutStopSec:         u.Service.TimeoutStopSec,
+			User:                   u.Service.User,
+			Group:                  u.Service.Group,
+			SupplementaryGroups:    spacedString(u.Service.SupplementaryGroups),
+			Sockets:                spacedString(u.Service.Sockets),
+			CapabilityBoundingSet:  spacedString(u.Service.CapabilityBoundingSet),
+			AmbientCapabilities:    spacedString(u.Service.AmbientCapabilities),
+			RestartKillSignal:      u.Service.RestartKillSignal,
+			FinalKillSignal:        u.Service.FinalKillSignal,
+			CPUWeight:              intString(u.Service.CPUWeight),
+			IOWeight:               intString(u.Service.IOWeight),
+			MemoryHigh:             u.Service.MemoryHigh,
+			MemoryLow:              u.Service.MemoryLow,
 		},
+		Install: installDirectiveToToml(u.Install),
 	}
+	return encodeUnitFile(ut)
+}
 
+// Encode toml struct to unit file format.
+func encodeUnitFile(v any) ([]byte, error) {
 	// Encode to toml
 	b := &bytes.Buffer{}
 	indent := ""
-	err := toml.Encode(b, ut, toml.EncodeOption{
+	err := toml.Encode(b, v, toml.EncodeOption{
 		Indent: &indent,
 	})
 	if err != nil {
@@ -132,72 +261,431 @@ func MarshalUnitFile(u UnitFileService) ([]byte, error) {
 	b.WriteString("\n")
 
 	// Convert to UnitFile format
-	s := strings.ReplaceAll(b.String(), " = \"", "=")
-	s = strings.ReplaceAll(s, "\"\n", "\n")
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		k, v, found := strings.Cut(l, " = ")
+		if !found {
+			continue
+		}
+		if strings.HasPrefix(v, "[") {
+			// repeatable directive, write each value on own line
+			values := struct{ V []string }{}
+			err := toml.Decode(strings.NewReader("V = "+v), &values)
+			if err != nil {
+				return nil, err
+			}
+			directives := make([]string, len(values.V))
+			for j, v := range values.V {
+				directives[j] = strings.Join([]string{k, "=", v}, "")
+			}
+			lines[i] = strings.Join(directives, "\n")
+			continue
+		}
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			v = unquoted
+		}
+		if k == "ManagedEnvironmentFile" {
+			lines[i] = strings.Join([]string{managedEnvironmentFileAnnotation, "\n", "EnvironmentFile=", v}, "")
+			continue
+		}
+		lines[i] = strings.Join([]string{k, "=", v}, "")
+	}
 
-	return []byte(s), nil
+	return []byte(strings.Join(lines, "\n")), nil
 }
 
-func UnmarshalUnitFile(b *bytes.Buffer) (u UnitFileService, err error) {
-	// Convert to toml format
-	b2 := &bytes.Buffer{}
-	for _, l := range strings.Split(b.String(), "\n") {
-		sp := strings.Split(l, "=")
-		if len(sp) < 2 {
-			b2.WriteString(strings.Join([]string{sp[0], "\n"}, ""))
-			break
-		}
-		s := []string{sp[0], " = \""}
-		s = append(s, sp[1:]...)
-		s = append(s, "\"\n")
-		b2.WriteString(strings.Join(s, ""))
+// Render unit file by `t` instead of `MarshalUnitFile()`.
+// Template receives `u` as data.
+func ExecuteUnitFileTemplate(t *template.Template, u UnitFileService) ([]byte, error) {
+	b := &bytes.Buffer{}
+	err := t.Execute(b, u)
+	if err != nil {
+		return nil, err
 	}
+	return b.Bytes(), nil
+}
 
-	// Decode toml
+func UnmarshalUnitFile(b *bytes.Buffer) (u UnitFileService, err error) {
 	ut := &unitFileServiceToml{}
-	err = toml.Decode(b2, ut)
+	err = decodeUnitFile(b, ut)
+	if err != nil {
+		return
+	}
+
+	cpuWeight, err := intPointer(ut.Service.CPUWeight)
+	if err != nil {
+		return
+	}
+	ioWeight, err := intPointer(ut.Service.IOWeight)
 	if err != nil {
 		return
 	}
 
 	u = UnitFileService{
-		Unit: UnitDirective{
-			Description:   ut.Unit.Description,
-			Documentation: ut.Unit.Documentation,
-			After:         slice(ut.Unit.After),
-			Requires:      slice(ut.Unit.Requires),
-			Wants:         slice(ut.Unit.Wants),
-			Conflicts:     slice(ut.Unit.Conflicts),
-		},
+		Unit: unitDirectiveFromToml(ut.Unit),
 		Service: ServiceDirective{
-			Type:            ut.Service.Type,
-			EnvironmentFile: ut.Service.EnvironmentFile,
-			ExecStart:       ut.Service.ExecStart,
-			ExecStop:        ut.Service.ExecStop,
-			ExecReload:      ut.Service.ExecReload,
-			Restart:         ut.Service.Restart,
-			RemainAfterExit: ut.Service.RemainAfterExit,
-		},
-		Install: InstallDirective{
-			Alias:           slice(ut.Install.Alias),
-			RequiredBy:      slice(ut.Install.RequiredBy),
-			WantedBy:        slice(ut.Install.WantedBy),
-			Also:            slice(ut.Install.Also),
-			DefaultInstance: ut.Install.DefaultInstance,
+			Type:                  ut.Service.Type,
+			EnvironmentFile:       ut.Service.ManagedEnvironmentFile,
+			ExtraEnvironmentFiles: ut.Service.EnvironmentFile,
+			Environment:           environmentMap(ut.Service.Environment),
+			ExecStartPre:          execCommands(ut.Service.ExecStartPre),
+			ExecStart:             ParseExecCommand(ut.Service.ExecStart),
+			ExecSearchPath:        colonSlice(ut.Service.ExecSearchPath),
+			ExecStop:              execCommands(ut.Service.ExecStop),
+			ExecReload:            execCommands(ut.Service.ExecReload),
+			Restart:               ut.Service.Restart,
+			RemainAfterExit:       ut.Service.RemainAfterExit,
+			TimeoutSec:            ut.Service.TimeoutSec,
+			TimeoutStartSec:       ut.Service.TimeoutStartSec,
+			TimeoutStopSec:        ut.Service.TimeoutStopSec,
+			User:                  ut.Service.User,
+			Group:                 ut.Service.Group,
+			SupplementaryGroups:   slice(ut.Service.SupplementaryGroups),
+			Sockets:               slice(ut.Service.Sockets),
+			CapabilityBoundingSet: slice(ut.Service.CapabilityBoundingSet),
+			AmbientCapabilities:   slice(ut.Service.AmbientCapabilities),
+			RestartKillSignal:     ut.Service.RestartKillSignal,
+			FinalKillSignal:       ut.Service.FinalKillSignal,
+			CPUWeight:             cpuWeight,
+			IOWeight:              ioWeight,
+			MemoryHigh:            ut.Service.MemoryHigh,
+			MemoryLow:             ut.Service.MemoryLow,
 		},
+		Install: installDirectiveFromToml(ut.Install),
 	}
 
 	return
 }
 
+// Directives accumulated over lines into one space separated list.
+// Empty value resets list (same as systemd).
+var listDirectives = map[string]bool{
+	"Documentation": true, "After": true, "Requires": true, "Wants": true,
+	"PartOf": true, "Conflicts": true, "ConditionControlGroupController": true,
+	"Environment": true, "SupplementaryGroups": true, "Sockets": true,
+	"CapabilityBoundingSet": true, "AmbientCapabilities": true,
+	"Alias": true, "RequiredBy": true, "WantedBy": true, "Also": true,
+}
+
+// Directives kept for each line in order, decoded as toml array.
+// Empty value resets values (same as systemd).
+var repeatedDirectives = map[string]bool{
+	"ConditionMemory": true, "ConditionCPUs": true, "ConditionNeedsUpdate": true,
+	"EnvironmentFile": true, "ExecStartPre": true, "ExecStop": true, "ExecReload": true,
+}
+
+type directive struct {
+	key    string
+	values []string
+}
+
+// Decode unit file format to toml struct.
+// Other directives specified multiple times take last value.
+func decodeUnitFile(b *bytes.Buffer, v any) error {
+	// Convert to toml format
+	b2 := &bytes.Buffer{}
+	section := []*directive{}
+	managedEnvFile := false
+	for _, l := range strings.Split(normalizeLines(b.String()), "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") {
+			// section
+			writeDirectivesToml(b2, section)
+			section = []*directive{}
+			b2.WriteString(strings.Join([]string{l, "\n"}, ""))
+			continue
+		}
+		if l == managedEnvironmentFileAnnotation {
+			// next `EnvironmentFile=` is managed env file
+			managedEnvFile = true
+			continue
+		}
+		sp := strings.SplitN(l, "=", 2)
+		if len(sp) < 2 || strings.HasPrefix(l, "#") || strings.HasPrefix(l, ";") {
+			// comment or empty line
+			continue
+		}
+		key := strings.TrimSpace(sp[0])
+		value := strings.TrimSpace(sp[1])
+		if managedEnvFile {
+			if key == "EnvironmentFile" {
+				key = "ManagedEnvironmentFile"
+			}
+			managedEnvFile = false
+		}
+
+		var d *directive
+		for _, d2 := range section {
+			if d2.key == key {
+				d = d2
+			}
+		}
+		if d == nil {
+			d = &directive{key: key}
+			section = append(section, d)
+		}
+		if key == "ExecStart" && len(d.values) != 0 && d.values[0] != "" && value != "" {
+			// multiple commands (`Type=oneshot`) are not modeled
+			return ErrExecStartRepeated
+		}
+		if !listDirectives[key] && !repeatedDirectives[key] {
+			// last value
+			d.values = []string{value}
+		} else if value == "" {
+			// reset
+			d.values = nil
+		} else {
+			d.values = append(d.values, value)
+		}
+	}
+	writeDirectivesToml(b2, section)
+
+	// Decode toml
+	return toml.Decode(b2, v)
+}
+
+func writeDirectivesToml(b *bytes.Buffer, directives []*directive) {
+	for _, d := range directives {
+		if len(d.values) == 0 {
+			continue
+		}
+		var value string
+		if repeatedDirectives[d.key] {
+			quoted := make([]string, len(d.values))
+			for i, v := range d.values {
+				quoted[i] = quote(v)
+			}
+			value = "[" + strings.Join(quoted, ", ") + "]"
+		} else {
+			value = quote(strings.Join(d.values, " "))
+		}
+		b.WriteString(strings.Join([]string{d.key, " = ", value, "\n"}, ""))
+	}
+}
+
+func unitDirectiveToToml(d UnitDirective) unitDirectiveToml {
+	return unitDirectiveToml{
+		Description:                     d.Description,
+		Documentation:                   d.Documentation,
+		After:                           spacedString(d.After),
+		Requires:                        spacedString(d.Requires),
+		Wants:                           spacedString(d.Wants),
+		PartOf:                          spacedString(d.PartOf),
+		Conflicts:                       spacedString(d.Conflicts),
+		StartLimitAction:                d.StartLimitAction,
+		ConditionMemory:                 d.ConditionMemory,
+		ConditionCPUs:                   d.ConditionCPUs,
+		ConditionNeedsUpdate:            d.ConditionNeedsUpdate,
+		ConditionControlGroupController: d.ConditionControlGroupController,
+	}
+}
+
+func unitDirectiveFromToml(d unitDirectiveToml) UnitDirective {
+	return UnitDirective{
+		Description:                     d.Description,
+		Documentation:                   d.Documentation,
+		After:                           slice(d.After),
+		Requires:                        slice(d.Requires),
+		Wants:                           slice(d.Wants),
+		PartOf:                          slice(d.PartOf),
+		Conflicts:                       slice(d.Conflicts),
+		StartLimitAction:                d.StartLimitAction,
+		ConditionMemory:                 nonEmpty(d.ConditionMemory),
+		ConditionCPUs:                   nonEmpty(d.ConditionCPUs),
+		ConditionNeedsUpdate:            nonEmpty(d.ConditionNeedsUpdate),
+		ConditionControlGroupController: d.ConditionControlGroupController,
+	}
+}
+
+func installDirectiveToToml(d InstallDirective) installDirectiveToml {
+	return installDirectiveToml{
+		Alias:           spacedString(d.Alias),
+		RequiredBy:      spacedString(d.RequiredBy),
+		WantedBy:        spacedString(d.WantedBy),
+		Also:            spacedString(d.Also),
+		DefaultInstance: d.DefaultInstance,
+	}
+}
+
+func installDirectiveFromToml(d installDirectiveToml) InstallDirective {
+	return InstallDirective{
+		Alias:           slice(d.Alias),
+		RequiredBy:      slice(d.RequiredBy),
+		WantedBy:        slice(d.WantedBy),
+		Also:            slice(d.Also),
+		DefaultInstance: d.DefaultInstance,
+	}
+}
+
 func slice(s *string) []string {
 	if s == nil {
 		return nil
 	}
-	return strings.Split(*s, " ")
+	f := strings.Fields(*s)
+	if len(f) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Convert CRLF to LF and trim trailing whitespaces of each line.
+func normalizeLines(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Double quote `s`, escaping `\` and `"`.
+// Same format for toml basic string and systemd quoted word.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func intString(i *int) *string {
+	if i == nil {
+		return nil
+	}
+	s := strconv.Itoa(*i)
+	return &s
+}
+
+func intPointer(s *string) (*int, error) {
+	if s == nil {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
 }
 
 func spacedString(s []string) *string {
 	s2 := strings.Join(s, " ")
 	return &s2
 }
+
+func nonEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func colonString(s []string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+	s2 := strings.Join(s, ":")
+	return &s2
+}
+
+func colonSlice(s *string) []string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return strings.Split(*s, ":")
+}
+
+// Format `Environment=` value.
+// e.g. `A=1 "B=word1 word2"`
+func environmentString(e map[string]string) *string {
+	if len(e) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	words := make([]string, 0, len(keys))
+	for _, k := range keys {
+		w := k + "=" + e[k]
+		if strings.ContainsAny(w, " \t\n\"'\\") {
+			w = quote(w)
+		}
+		// escape specifier
+		w = strings.ReplaceAll(w, "%", "%%")
+		words = append(words, w)
+	}
+	s := strings.Join(words, " ")
+	return &s
+}
+
+// Parse `Environment=` value.
+func environmentMap(s *string) map[string]string {
+	if s == nil {
+		return nil
+	}
+	e := map[string]string{}
+	for _, w := range splitQuoted(*s) {
+		k, v, _ := strings.Cut(w, "=")
+		e[k] = v
+	}
+	return e
+}
+
+// C-style escapes unescaped in `Environment=` (same as systemd)
+var cEscapes = map[rune]rune{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', 's': ' ',
+}
+
+// Split space separated words.
+// Double or single quoted word can contain spaces, C-style escapes (e.g. `\n`)
+// are unescaped, `\` escapes other characters and `%%` is unescaped to `%`.
+func splitQuoted(s string) []string {
+	words := []string{}
+	word := strings.Builder{}
+	inWord, escaped, specifier := false, false, false
+	var quoteChar rune
+	for _, r := range s {
+		switch {
+		case escaped:
+			if c, ok := cEscapes[r]; ok {
+				r = c
+			}
+			word.WriteRune(r)
+			escaped = false
+		case specifier:
+			// `%%`, other specifiers are kept as it is
+			if r != '%' {
+				word.WriteRune('%')
+			}
+			word.WriteRune(r)
+			specifier = false
+		case r == '%':
+			inWord, specifier = true, true
+		case r == '\\':
+			inWord, escaped = true, true
+		case (r == '"' || r == '\'') && (quoteChar == 0 || quoteChar == r):
+			inWord = true
+			if quoteChar == 0 {
+				quoteChar = r
+			} else {
+				quoteChar = 0
+			}
+		case quoteChar == 0 && (r == ' ' || r == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if specifier {
+		word.WriteRune('%')
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
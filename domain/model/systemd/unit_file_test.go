@@ -0,0 +1,533 @@
+package systemd
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalUnitFile(t *testing.T) {
+	memory := ">=4G"
+	cpus := ">2"
+	needsUpdate := "!/etc"
+	cgroupController := "cpu memory"
+
+	tests := []struct {
+		name    string
+		u       UnitFileService
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "conditions with comparison operator",
+			u: UnitFileService{
+				Unit: UnitDirective{
+					Description:          "app",
+					ConditionMemory:      []string{memory},
+					ConditionCPUs:        []string{cpus},
+					ConditionNeedsUpdate: []string{needsUpdate},
+				},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			want: []string{
+				"ConditionMemory=>=4G\n",
+				"ConditionCPUs=>2\n",
+				"ConditionNeedsUpdate=!/etc\n",
+			},
+			wantErr: false,
+		},
+		{
+			name: "ExecSearchPath",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:      ExecCommand{Command: "app"},
+					ExecSearchPath: []string{"/opt/app/bin", "/usr/local/bin"},
+				},
+			},
+			want:    []string{"ExecSearchPath=/opt/app/bin:/usr/local/bin\n"},
+			wantErr: false,
+		},
+		{
+			name: "capabilities",
+			u: UnitFileService{
+				Unit: UnitDirective{
+					Description:                     "app",
+					ConditionControlGroupController: &cgroupController,
+				},
+				Service: ServiceDirective{
+					ExecStart:             ExecCommand{Command: "/usr/bin/app"},
+					CapabilityBoundingSet: []string{"CAP_NET_BIND_SERVICE", "CAP_CHOWN"},
+					AmbientCapabilities:   []string{"CAP_NET_BIND_SERVICE"},
+				},
+			},
+			want: []string{
+				"ConditionControlGroupController=cpu memory\n",
+				"CapabilityBoundingSet=CAP_NET_BIND_SERVICE CAP_CHOWN\n",
+				"AmbientCapabilities=CAP_NET_BIND_SERVICE\n",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Environment with single quote and percent",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					Environment: map[string]string{"A": "it's", "P": "100%"},
+					ExecStart:   ExecCommand{Command: "/usr/bin/app"},
+				},
+			},
+			want:    []string{`Environment="A=it's" P=100%%` + "\n"},
+			wantErr: false,
+		},
+		{
+			name: "Environment with newline",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					Environment: map[string]string{"A": "a\tb", "N": "line1\nline2"},
+					ExecStart:   ExecCommand{Command: "/usr/bin/app"},
+				},
+			},
+			want:    []string{"Environment=\"A=a\tb\" \"N=line1\\nline2\"\n"},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MarshalUnitFile(tt.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MarshalUnitFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(got), w) {
+					t.Errorf("MarshalUnitFile() = %v, want contains %v", string(got), w)
+				}
+			}
+
+			u, err := UnmarshalUnitFile(bytes.NewBuffer(got))
+			if err != nil {
+				t.Fatalf("UnmarshalUnitFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(u, tt.u) {
+				t.Errorf("UnmarshalUnitFile() = %v, want %v", u, tt.u)
+			}
+		})
+	}
+}
+
+func TestUnmarshalUnitFile(t *testing.T) {
+	simple := UnitTypeSimple
+	envFile := "/etc/default/app"
+	reboot := "reboot"
+	cpuWeight := 200
+	ioWeight := 50
+	memoryHigh := "1G"
+	memoryLow := "infinity"
+	sigInt := "SIGINT"
+	sigKill := "SIGKILL"
+	timeout := "30s"
+	timeoutStop := "1min"
+
+	tests := []struct {
+		name    string
+		u       UnitFileService
+		wantErr bool
+	}{
+		{
+			name: "round-trip",
+			u: UnitFileService{
+				Unit: UnitDirective{
+					Description:   "app",
+					Documentation: "https://example.com",
+					After:         []string{"network.target", "syslog.target"},
+				},
+				Service: ServiceDirective{
+					Type:            &simple,
+					EnvironmentFile: &envFile,
+					ExecStart:       ExecCommand{Command: "/usr/bin/app --addr=:8080"},
+				},
+				Install: InstallDirective{
+					WantedBy: []string{"multi-user.target"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Also",
+			u: UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+				Install: InstallDirective{
+					WantedBy: []string{"multi-user.target"},
+					Also:     []string{"app.timer", "app.socket"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "StartLimitAction",
+			u: UnitFileService{
+				Unit:    UnitDirective{Description: "app", StartLimitAction: &reboot},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Exec prefixes",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStartPre: []ExecCommand{{IgnoreFailure: true, Command: "/usr/bin/migrate"}},
+					ExecStart:    ExecCommand{OverrideArgv0: true, Command: "/usr/bin/app app"},
+					ExecStop:     []ExecCommand{{FullPrivileges: true, Command: "/usr/bin/app stop"}},
+					ExecReload:   []ExecCommand{{IgnoreFailure: true, FullPrivileges: true, Command: "/bin/kill -HUP $MAINPID"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "resource controls",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:  ExecCommand{Command: "/usr/bin/app"},
+					CPUWeight:  &cpuWeight,
+					IOWeight:   &ioWeight,
+					MemoryHigh: &memoryHigh,
+					MemoryLow:  &memoryLow,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "kill signals",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart:         ExecCommand{Command: "/usr/bin/app"},
+					RestartKillSignal: &sigInt,
+					FinalKillSignal:   &sigKill,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Sockets",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExecStart: ExecCommand{Command: "/usr/bin/app"},
+					Sockets:   []string{"app.socket", "app-admin.socket"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unmanaged env files only",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: "app"},
+				Service: ServiceDirective{
+					ExtraEnvironmentFiles: []string{"/etc/extra"},
+					ExecStart:             ExecCommand{Command: "/usr/bin/app"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "TimeoutSec",
+			u: UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, TimeoutSec: &timeout},
+			},
+			wantErr: false,
+		},
+		{
+			name: "TimeoutStartSec and TimeoutStopSec",
+			u: UnitFileService{
+				Unit:    UnitDirective{Description: "app"},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, TimeoutStartSec: &timeout, TimeoutStopSec: &timeoutStop},
+			},
+			wantErr: false,
+		},
+		{
+			name: "repeated directives",
+			u: UnitFileService{
+				Unit: UnitDirective{
+					Description:     "app",
+					ConditionMemory: []string{">=1G", "<=8G"},
+					ConditionCPUs:   []string{">=2", "<=16"},
+				},
+				Service: ServiceDirective{
+					EnvironmentFile:       &envFile,
+					ExtraEnvironmentFiles: []string{"/etc/app/common.env", "-/etc/app/local.env"},
+					ExecStartPre: []ExecCommand{
+						{Command: "/bin/mkdir -p /var/lib/app"},
+						{IgnoreFailure: true, Command: "/usr/bin/migrate"},
+						{Command: "/bin/mkdir -p /var/lib/app"},
+					},
+					ExecStart: ExecCommand{Command: "/usr/bin/app"},
+					ExecStop: []ExecCommand{
+						{Command: "/usr/bin/app drain"},
+						{Command: "/usr/bin/app stop"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "quoted values",
+			u: UnitFileService{
+				Unit: UnitDirective{Description: `app "quoted"`},
+				Service: ServiceDirective{
+					Environment: map[string]string{
+						"PORT":    "8080",
+						"MESSAGE": "hello world",
+						"QUOTED":  `say "hi"`,
+						"PATTERN": `a\b`,
+						"EMPTY":   "",
+					},
+					ExecStart: ExecCommand{Command: `/bin/sh -c "echo \"$PORT\""`},
+				},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := MarshalUnitFile(tt.u)
+			if err != nil {
+				t.Fatalf("MarshalUnitFile() error = %v", err)
+			}
+			b2 := bytes.NewBufferString(annotation)
+			b2.Write(b)
+			got, err := UnmarshalUnitFile(b2)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UnmarshalUnitFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.u) {
+				t.Errorf("UnmarshalUnitFile() = %v, want %v", got, tt.u)
+			}
+		})
+	}
+}
+
+func TestUnmarshalUnitFile_repeated(t *testing.T) {
+	in := strings.Join([]string{
+		"[Unit]",
+		"Description=old",
+		"Description=app",
+		"After=network.target",
+		"# comment",
+		"After=syslog.target",
+		"",
+		"[Service]",
+		"EnvironmentFile=/etc/default/app",
+		managedEnvironmentFileAnnotation,
+		"EnvironmentFile=/var/lib/app/.env",
+		"ExecStartPre=/bin/true",
+		"ExecStartPre=",
+		"ExecStartPre=/bin/mkdir -p /var/lib/app",
+		"ExecStartPre=/usr/bin/migrate",
+		"ExecStart=/usr/bin/app",
+		"",
+		"[Install]",
+		"WantedBy=multi-user.target",
+		"WantedBy=",
+		"WantedBy=app.target",
+		"",
+	}, "\n")
+	envFile := "/var/lib/app/.env"
+	want := UnitFileService{
+		Unit: UnitDirective{
+			Description: "app",
+			After:       []string{"network.target", "syslog.target"},
+		},
+		Service: ServiceDirective{
+			EnvironmentFile:       &envFile,
+			ExtraEnvironmentFiles: []string{"/etc/default/app"},
+			ExecStartPre: []ExecCommand{
+				{Command: "/bin/mkdir -p /var/lib/app"},
+				{Command: "/usr/bin/migrate"},
+			},
+			ExecStart: ExecCommand{Command: "/usr/bin/app"},
+		},
+		Install: InstallDirective{
+			WantedBy: []string{"app.target"},
+		},
+	}
+
+	got, err := UnmarshalUnitFile(bytes.NewBufferString(in))
+	if err != nil {
+		t.Fatalf("UnmarshalUnitFile() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalUnitFile() = %v, want %v", got, want)
+	}
+}
+
+func TestUnmarshalUnitFile_execStartRepeated(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "repeated",
+			in:      "[Service]\nType=oneshot\nExecStart=/usr/bin/a\nExecStart=/usr/bin/b\n",
+			wantErr: ErrExecStartRepeated,
+		},
+		{
+			name:    "reset",
+			in:      "[Service]\nExecStart=/usr/bin/a\nExecStart=\nExecStart=/usr/bin/b\n",
+			want:    "/usr/bin/b",
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalUnitFile(bytes.NewBufferString(tt.in))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UnmarshalUnitFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Service.ExecStart.Command != tt.want {
+				t.Errorf("ExecStart = %v, want %v", got.Service.ExecStart.Command, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalUnitFile_whitespace(t *testing.T) {
+	simple := UnitTypeSimple
+	want := UnitFileService{
+		Unit: UnitDirective{
+			Description: "app",
+			After:       []string{"network.target", "syslog.target"},
+		},
+		Service: ServiceDirective{
+			Type:      &simple,
+			ExecStart: ExecCommand{Command: "/usr/bin/app --port 8080"},
+		},
+		Install: InstallDirective{
+			WantedBy: []string{"multi-user.target"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "CRLF",
+			in:   "[Unit]\r\nDescription=app\r\nAfter=network.target syslog.target\r\n\r\n[Service]\r\nType=simple\r\nExecStart=/usr/bin/app --port 8080\r\n\r\n[Install]\r\nWantedBy=multi-user.target\r\n",
+		},
+		{
+			name: "trailing whitespaces",
+			in:   "[Unit] \nDescription=app  \nAfter=network.target  syslog.target\t\n\n[Service]\nType=simple \nExecStart=/usr/bin/app --port 8080 \n\n[Install]\nWantedBy=multi-user.target \n",
+		},
+		{
+			name: "whitespaces around equal sign",
+			in:   "[Unit]\nDescription = app\nAfter = network.target syslog.target\n\n[Service]\nType = simple\nExecStart = /usr/bin/app --port 8080\n\n[Install]\nWantedBy = multi-user.target\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalUnitFile(bytes.NewBufferString(tt.in))
+			if err != nil {
+				t.Fatalf("UnmarshalUnitFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("UnmarshalUnitFile() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestServiceDirective_EffectiveTimeout(t *testing.T) {
+	timeout := "30s"
+	timeoutStart := "10s"
+	timeoutStop := "1min"
+
+	tests := []struct {
+		name      string
+		d         ServiceDirective
+		wantStart *string
+		wantStop  *string
+	}{
+		{
+			name:      "not set",
+			d:         ServiceDirective{},
+			wantStart: nil,
+			wantStop:  nil,
+		},
+		{
+			name:      "TimeoutSec expanded",
+			d:         ServiceDirective{TimeoutSec: &timeout},
+			wantStart: &timeout,
+			wantStop:  &timeout,
+		},
+		{
+			name:      "specific timeouts",
+			d:         ServiceDirective{TimeoutStartSec: &timeoutStart, TimeoutStopSec: &timeoutStop},
+			wantStart: &timeoutStart,
+			wantStop:  &timeoutStop,
+		},
+		{
+			name:      "TimeoutStartSec only",
+			d:         ServiceDirective{TimeoutStartSec: &timeoutStart},
+			wantStart: &timeoutStart,
+			wantStop:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.EffectiveTimeoutStartSec(); !reflect.DeepEqual(got, tt.wantStart) {
+				t.Errorf("EffectiveTimeoutStartSec() = %v, want %v", got, tt.wantStart)
+			}
+			if got := tt.d.EffectiveTimeoutStopSec(); !reflect.DeepEqual(got, tt.wantStop) {
+				t.Errorf("EffectiveTimeoutStopSec() = %v, want %v", got, tt.wantStop)
+			}
+		})
+	}
+}
+
+func Test_environmentMap(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want map[string]string
+	}{
+		{
+			name: "double quoted",
+			s:    `"A=hello world" B=1`,
+			want: map[string]string{"A": "hello world", "B": "1"},
+		},
+		{
+			name: "single quoted",
+			s:    `'A=hello world' 'B=say "hi"'`,
+			want: map[string]string{"A": "hello world", "B": `say "hi"`},
+		},
+		{
+			name: "escaped specifier",
+			s:    `P=100%% "Q=50%% off"`,
+			want: map[string]string{"P": "100%", "Q": "50% off"},
+		},
+		{
+			name: "C-style escapes",
+			s:    `"A=a\nb\tc" "B=say \"hi\"" 'C=back\\slash'`,
+			want: map[string]string{"A": "a\nb\tc", "B": `say "hi"`, "C": `back\slash`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := environmentMap(&tt.s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("environmentMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
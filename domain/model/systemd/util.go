@@ -2,15 +2,21 @@ package systemd
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 )
 
-func mkdirIfNotExist(path string) error {
+// Create directory with parents, mode is 0777 with umask applied (nil: 0755).
+func mkdirIfNotExist(path string, umask *os.FileMode) error {
 	_, err := os.ReadDir(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// if dir not exists, mkdir
-			err = os.MkdirAll(path, 0644)
+			var perm os.FileMode = 0755
+			if umask != nil {
+				perm = 0777 &^ *umask
+			}
+			err = os.MkdirAll(path, perm)
 			if err != nil {
 				return err
 			}
@@ -46,7 +52,7 @@ func readFile(path string, b *bytes.Buffer) error {
 	return nil
 }
 
-func writeFile(path string, b []byte) error {
+func writeFile(path string, b []byte, umask *os.FileMode) error {
 	// Open file
 	f, err := os.Create(path)
 	if err != nil {
@@ -54,7 +60,36 @@ func writeFile(path string, b []byte) error {
 	}
 	defer f.Close()
 
+	if umask != nil {
+		// Apply umask to file mode before write.
+		// Process umask is not changed, it is shared with concurrent deploys.
+		err = f.Chmod(0666 &^ *umask)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Write
 	_, err = f.Write(b)
 	return err
 }
+
+// Compare file content with `b`.
+// Line endings and trailing whitespaces are ignored.
+func fileChanged(path string, b []byte) (bool, error) {
+	loaded := &bytes.Buffer{}
+	err := readFile(path, loaded)
+	if err != nil {
+		return false, err
+	}
+	return normalizeLines(loaded.String()) != normalizeLines(string(b)), nil
+}
+
+// Wrap not found error by `ErrNoSuchFileOrDir` with operation and path.
+// Other errors are returned as it is.
+func wrapNotExist(err error, op string, path string) error {
+	if err != nil && os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s: %s", ErrNoSuchFileOrDir, op, path)
+	}
+	return err
+}
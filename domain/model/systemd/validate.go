@@ -0,0 +1,212 @@
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnitAliasInvalid          = errors.New("unit alias must be other name with `.service` suffix")
+	ErrExecStartRequired         = errors.New("`ExecStart=` is required")
+	ErrExecStartNotAbsolute      = errors.New("`ExecStart=` must be absolute path")
+	ErrUnitConflictsSelf         = errors.New("unit cannot conflict with itself")
+	ErrStartLimitActionInvalid   = errors.New("invalid `StartLimitAction=`")
+	ErrStartLimitActionDangerous = errors.New("`StartLimitAction=` affects host, dangerous actions are not allowed")
+	ErrCPUWeightOutOfRange       = errors.New("`CPUWeight=` must be in range 1-10000")
+	ErrIOWeightOutOfRange        = errors.New("`IOWeight=` must be in range 1-10000")
+	ErrMemoryHighInvalid         = errors.New("invalid `MemoryHigh=`")
+	ErrMemoryLowInvalid          = errors.New("invalid `MemoryLow=`")
+	ErrKillSignalInvalid         = errors.New("invalid kill signal")
+	ErrUnitSocketsInvalid        = errors.New("`Sockets=` must be units with `.socket` suffix")
+	ErrInvalidEnvKey             = errors.New("invalid env key")
+	ErrInvalidEnvValue           = errors.New("invalid env value")
+	ErrExecSearchPathUnsupported = errors.New("`ExecSearchPath=` requires systemd 250 or later")
+	ErrExecSearchPathNotAbsolute = errors.New("`ExecSearchPath=` must be absolute paths")
+	ErrSupplementaryGroupInvalid = errors.New("`SupplementaryGroups=` must be non-empty group names")
+	ErrTimeoutSecConflict        = errors.New("`TimeoutSec=` cannot be combined with `TimeoutStartSec=` or `TimeoutStopSec=`")
+)
+
+// Values of `StartLimitAction=` (true if action affects host)
+var startLimitActions = map[string]bool{
+	"none":               false,
+	"exit":               true,
+	"exit-force":         true,
+	"reboot":             true,
+	"reboot-force":       true,
+	"reboot-immediate":   true,
+	"soft-reboot":        true,
+	"soft-reboot-force":  true,
+	"kexec":              true,
+	"kexec-force":        true,
+	"poweroff":           true,
+	"poweroff-force":     true,
+	"poweroff-immediate": true,
+	"halt":               true,
+	"halt-force":         true,
+	"halt-immediate":     true,
+}
+
+// Bytes with optional suffix (K, M, G, T, P, E), percentage or `infinity`
+var memoryLimitRegexp = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?[KMGTPE]?|[0-9]+(\.[0-9]+)?%|infinity)$`)
+
+// Signal names accepted in `*KillSignal=` (without `SIG` prefix)
+var signals = map[string]bool{
+	"HUP": true, "INT": true, "QUIT": true, "ILL": true, "TRAP": true, "ABRT": true,
+	"BUS": true, "FPE": true, "KILL": true, "USR1": true, "SEGV": true, "USR2": true,
+	"PIPE": true, "ALRM": true, "TERM": true, "STKFLT": true, "CHLD": true, "CONT": true,
+	"STOP": true, "TSTP": true, "TTIN": true, "TTOU": true, "URG": true, "XCPU": true,
+	"XFSZ": true, "VTALRM": true, "PROF": true, "WINCH": true, "IO": true, "PWR": true,
+	"SYS": true,
+}
+
+// Real-time signals. e.g. `SIGRTMIN+1`, `RTMAX-2`
+var realtimeSignalRegexp = regexp.MustCompile(`^RT(MIN|MAX)([+-][0-9]+)?$`)
+
+// Check signal name (e.g. `SIGTERM`, `TERM`) or number (1-64).
+func isValidSignal(s string) bool {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n >= 1 && n <= 64
+	}
+	name := strings.TrimPrefix(s, "SIG")
+	return signals[name] || realtimeSignalRegexp.MatchString(name)
+}
+
+// Minimum systemd version supports `ExecSearchPath=`
+const execSearchPathMinVersion = 250
+
+// Env keys accepted by systemd
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate env keys and values before writing.
+// Invalid keys are ignored by systemd, newlines break env file format.
+func validateEnvironment(env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !envKeyRegexp.MatchString(k) {
+			return fmt.Errorf("%w: %q", ErrInvalidEnvKey, k)
+		}
+		if strings.ContainsAny(env[k], "\n\r\x00") {
+			return fmt.Errorf("%w: %s", ErrInvalidEnvValue, k)
+		}
+	}
+	return nil
+}
+
+// Validate unit file before writing.
+func validateUnitFileService(name string, u UnitFileService, o Option) error {
+	if u.Service.ExecStart.Command == "" {
+		return ErrExecStartRequired
+	}
+	if len(u.Service.ExecSearchPath) != 0 {
+		if o.SystemdVersion < execSearchPathMinVersion {
+			return ErrExecSearchPathUnsupported
+		}
+		for _, p := range u.Service.ExecSearchPath {
+			if !filepath.IsAbs(p) {
+				return ErrExecSearchPathNotAbsolute
+			}
+		}
+	}
+	if !isAbsoluteExecPath(u.Service.ExecStart.Command) {
+		// executable name without directory is searched in `ExecSearchPath=`
+		searched := len(u.Service.ExecSearchPath) != 0 && !strings.Contains(execBinary(u.Service.ExecStart.Command), "/")
+		if !searched {
+			return ErrExecStartNotAbsolute
+		}
+	}
+
+	// validate executables of `Exec*=`
+	commands := []ExecCommand{u.Service.ExecStart}
+	commands = append(commands, u.Service.ExecStartPre...)
+	commands = append(commands, u.Service.ExecStop...)
+	commands = append(commands, u.Service.ExecReload...)
+	for _, c := range commands {
+		if !isExecAllowed(c.Command, o.ExecAllowlist) {
+			return ErrExecNotAllowed
+		}
+	}
+
+	// validate `Conflicts=`
+	for _, c := range u.Unit.Conflicts {
+		if c == name+".service" || c == name {
+			return ErrUnitConflictsSelf
+		}
+	}
+
+	// validate `StartLimitAction=`
+	if u.Unit.StartLimitAction != nil {
+		dangerous, ok := startLimitActions[*u.Unit.StartLimitAction]
+		if !ok {
+			return ErrStartLimitActionInvalid
+		}
+		if dangerous && !o.AllowDangerousActions {
+			return ErrStartLimitActionDangerous
+		}
+	}
+
+	// validate resource controls
+	if w := u.Service.CPUWeight; w != nil && (*w < 1 || *w > 10000) {
+		return ErrCPUWeightOutOfRange
+	}
+	if w := u.Service.IOWeight; w != nil && (*w < 1 || *w > 10000) {
+		return ErrIOWeightOutOfRange
+	}
+	if m := u.Service.MemoryHigh; m != nil && !memoryLimitRegexp.MatchString(*m) {
+		return ErrMemoryHighInvalid
+	}
+	if m := u.Service.MemoryLow; m != nil && !memoryLimitRegexp.MatchString(*m) {
+		return ErrMemoryLowInvalid
+	}
+
+	// validate kill signals
+	for _, sig := range []*string{u.Service.RestartKillSignal, u.Service.FinalKillSignal} {
+		if sig != nil && !isValidSignal(*sig) {
+			return ErrKillSignalInvalid
+		}
+	}
+
+	// validate timeouts
+	// `TimeoutSec=` overrides or is overridden depending on order in unit file
+	if u.Service.TimeoutSec != nil && (u.Service.TimeoutStartSec != nil || u.Service.TimeoutStopSec != nil) {
+		return ErrTimeoutSecConflict
+	}
+
+	// validate `Environment=`
+	err := validateEnvironment(u.Service.Environment)
+	if err != nil {
+		return err
+	}
+
+	// validate `SupplementaryGroups=`
+	for _, g := range u.Service.SupplementaryGroups {
+		if g == "" || strings.ContainsAny(g, " \t") {
+			return ErrSupplementaryGroupInvalid
+		}
+	}
+
+	// validate `Sockets=`
+	for _, sock := range u.Service.Sockets {
+		if !strings.HasSuffix(sock, ".socket") {
+			return ErrUnitSocketsInvalid
+		}
+	}
+
+	// validate `Alias=`
+	// alias must have same unit type suffix as unit file
+	for _, a := range u.Install.Alias {
+		if !strings.HasSuffix(a, ".service") || a == name+".service" {
+			return ErrUnitAliasInvalid
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package systemd
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_validateUnitFileService(t *testing.T) {
+	none := "none"
+	reboot := "reboot"
+	invalid := "explode"
+	weight0 := 0
+	weight100 := 100
+	weight10001 := 10001
+	mem512M := "512M"
+	mem10p := "10%"
+	memInvalid := "512MB"
+	sigTerm := "SIGTERM"
+	sigNumber := "9"
+	sigRealtime := "SIGRTMIN+3"
+	sigInvalid := "SIGFOO"
+	sigOutOfRange := "65"
+	timeout30s := "30s"
+	timeout1min := "1min"
+
+	tests := []struct {
+		name    string
+		u       UnitFileService
+		o       Option
+		wantErr error
+	}{
+		{
+			name:    "absolute ExecStart",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/yarn start"}}},
+			wantErr: nil,
+		},
+		{
+			name:    "absolute ExecStart with prefix",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: ":/usr/bin/yarn start"}}},
+			wantErr: nil,
+		},
+		{
+			name:    "empty ExecStart",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: ""}}},
+			wantErr: ErrExecStartRequired,
+		},
+		{
+			name:    "relative ExecStart",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "yarn start"}}},
+			wantErr: ErrExecStartNotAbsolute,
+		},
+		{
+			name:    "ExecStart in allowlist",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app --port 8080"}}},
+			o:       Option{ExecAllowlist: []string{"/usr/local/bin/", "/usr/bin/app"}},
+			wantErr: nil,
+		},
+		{
+			name:    "ExecStart in allowed directory",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "-/usr/local/bin/app"}}},
+			o:       Option{ExecAllowlist: []string{"/usr/local/bin"}},
+			wantErr: nil,
+		},
+		{
+			name:    "ExecStart not in allowlist",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app2"}}},
+			o:       Option{ExecAllowlist: []string{"/usr/bin/app", "/usr/local/bin"}},
+			wantErr: ErrExecNotAllowed,
+		},
+		{
+			name:    "ExecStart escapes allowed directory",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/local/bin/../../bin/rm"}}},
+			o:       Option{ExecAllowlist: []string{"/usr/local/bin"}},
+			wantErr: ErrExecNotAllowed,
+		},
+		{
+			name:    "shell is checked instead of builtin",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/bin/sh -c 'echo ok'"}}},
+			o:       Option{ExecAllowlist: []string{"/usr/bin"}},
+			wantErr: ErrExecNotAllowed,
+		},
+		{
+			name: "ExecStartPre not in allowlist",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStartPre: []ExecCommand{{Command: "/bin/mkdir -p /var/lib/app"}},
+				ExecStart:    ExecCommand{Command: "/usr/bin/app"},
+			}},
+			o:       Option{ExecAllowlist: []string{"/usr/bin"}},
+			wantErr: ErrExecNotAllowed,
+		},
+		{
+			name: "kill signals",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:         ExecCommand{Command: "/usr/bin/app"},
+				RestartKillSignal: &sigTerm,
+				FinalKillSignal:   &sigNumber,
+			}},
+			wantErr: nil,
+		},
+		{
+			name: "realtime kill signal",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:         ExecCommand{Command: "/usr/bin/app"},
+				RestartKillSignal: &sigRealtime,
+			}},
+			wantErr: nil,
+		},
+		{
+			name: "RestartKillSignal invalid",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:         ExecCommand{Command: "/usr/bin/app"},
+				RestartKillSignal: &sigInvalid,
+			}},
+			wantErr: ErrKillSignalInvalid,
+		},
+		{
+			name: "FinalKillSignal out of range",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:       ExecCommand{Command: "/usr/bin/app"},
+				FinalKillSignal: &sigOutOfRange,
+			}},
+			wantErr: ErrKillSignalInvalid,
+		},
+		{
+			name: "Sockets",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart: ExecCommand{Command: "/usr/bin/app"},
+				Sockets:   []string{"app.socket", "app-admin.socket"},
+			}},
+			wantErr: nil,
+		},
+		{
+			name: "Sockets without suffix",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart: ExecCommand{Command: "/usr/bin/app"},
+				Sockets:   []string{"app"},
+			}},
+			wantErr: ErrUnitSocketsInvalid,
+		},
+		{
+			name: "invalid inline Environment key",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:   ExecCommand{Command: "/usr/bin/app"},
+				Environment: map[string]string{"9LIVES": "cat"},
+			}},
+			wantErr: ErrInvalidEnvKey,
+		},
+		{
+			name: "ExecSearchPath relaxes absolute ExecStart",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:      ExecCommand{Command: "-app --port 8080"},
+				ExecSearchPath: []string{"/opt/app/bin", "/usr/bin"},
+			}},
+			o:       Option{SystemdVersion: 252},
+			wantErr: nil,
+		},
+		{
+			name: "ExecSearchPath does not relax relative path",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:      ExecCommand{Command: "./bin/app"},
+				ExecSearchPath: []string{"/opt/app"},
+			}},
+			o:       Option{SystemdVersion: 252},
+			wantErr: ErrExecStartNotAbsolute,
+		},
+		{
+			name: "ExecSearchPath on old systemd",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:      ExecCommand{Command: "app"},
+				ExecSearchPath: []string{"/opt/app/bin"},
+			}},
+			o:       Option{SystemdVersion: 249},
+			wantErr: ErrExecSearchPathUnsupported,
+		},
+		{
+			name: "ExecSearchPath on unknown systemd",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:      ExecCommand{Command: "app"},
+				ExecSearchPath: []string{"/opt/app/bin"},
+			}},
+			wantErr: ErrExecSearchPathUnsupported,
+		},
+		{
+			name: "ExecSearchPath not absolute",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:      ExecCommand{Command: "app"},
+				ExecSearchPath: []string{"bin"},
+			}},
+			o:       Option{SystemdVersion: 252},
+			wantErr: ErrExecSearchPathNotAbsolute,
+		},
+		{
+			name: "SupplementaryGroups",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:           ExecCommand{Command: "/usr/bin/app"},
+				SupplementaryGroups: []string{"dialout", "video"},
+			}},
+			wantErr: nil,
+		},
+		{
+			name: "SupplementaryGroups empty name",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:           ExecCommand{Command: "/usr/bin/app"},
+				SupplementaryGroups: []string{"dialout", ""},
+			}},
+			wantErr: ErrSupplementaryGroupInvalid,
+		},
+		{
+			name: "conflicts with itself",
+			u: UnitFileService{
+				Unit:    UnitDirective{Conflicts: []string{"other.service", "app.service"}},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			wantErr: ErrUnitConflictsSelf,
+		},
+		{
+			name: "StartLimitAction none",
+			u: UnitFileService{
+				Unit:    UnitDirective{StartLimitAction: &none},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "StartLimitAction invalid",
+			u: UnitFileService{
+				Unit:    UnitDirective{StartLimitAction: &invalid},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			o:       Option{AllowDangerousActions: true},
+			wantErr: ErrStartLimitActionInvalid,
+		},
+		{
+			name: "StartLimitAction reboot not allowed",
+			u: UnitFileService{
+				Unit:    UnitDirective{StartLimitAction: &reboot},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			wantErr: ErrStartLimitActionDangerous,
+		},
+		{
+			name: "StartLimitAction reboot allowed",
+			u: UnitFileService{
+				Unit:    UnitDirective{StartLimitAction: &reboot},
+				Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}},
+			},
+			o:       Option{AllowDangerousActions: true},
+			wantErr: nil,
+		},
+		{
+			name: "resource controls",
+			u: UnitFileService{Service: ServiceDirective{
+				ExecStart:  ExecCommand{Command: "/usr/bin/app"},
+				CPUWeight:  &weight100,
+				IOWeight:   &weight100,
+				MemoryHigh: &mem512M,
+				MemoryLow:  &mem10p,
+			}},
+			wantErr: nil,
+		},
+		{
+			name:    "CPUWeight too small",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, CPUWeight: &weight0}},
+			wantErr: ErrCPUWeightOutOfRange,
+		},
+		{
+			name:    "IOWeight too large",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, IOWeight: &weight10001}},
+			wantErr: ErrIOWeightOutOfRange,
+		},
+		{
+			name:    "MemoryHigh invalid",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, MemoryHigh: &memInvalid}},
+			wantErr: ErrMemoryHighInvalid,
+		},
+		{
+			name:    "MemoryLow invalid",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, MemoryLow: &memInvalid}},
+			wantErr: ErrMemoryLowInvalid,
+		},
+		{
+			name:    "TimeoutSec",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, TimeoutSec: &timeout30s}},
+			wantErr: nil,
+		},
+		{
+			name:    "TimeoutStartSec and TimeoutStopSec",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, TimeoutStartSec: &timeout30s, TimeoutStopSec: &timeout1min}},
+			wantErr: nil,
+		},
+		{
+			name:    "TimeoutSec with TimeoutStopSec",
+			u:       UnitFileService{Service: ServiceDirective{ExecStart: ExecCommand{Command: "/usr/bin/app"}, TimeoutSec: &timeout30s, TimeoutStopSec: &timeout1min}},
+			wantErr: ErrTimeoutSecConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateUnitFileService("app", tt.u, tt.o); !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateUnitFileService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateEnvironment(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr error
+	}{
+		{name: "empty", env: nil, wantErr: nil},
+		{
+			name: "valid edge cases",
+			env: map[string]string{
+				"_":          "",
+				"_PRIVATE":   "a b",
+				"lower_case": "x=y",
+				"KEY2":       `quoted "value" \ tab	`,
+			},
+			wantErr: nil,
+		},
+		{name: "leading digit", env: map[string]string{"1KEY": "v"}, wantErr: ErrInvalidEnvKey},
+		{name: "space in key", env: map[string]string{"MY KEY": "v"}, wantErr: ErrInvalidEnvKey},
+		{name: "hyphen in key", env: map[string]string{"MY-KEY": "v"}, wantErr: ErrInvalidEnvKey},
+		{name: "empty key", env: map[string]string{"": "v"}, wantErr: ErrInvalidEnvKey},
+		{name: "newline in value", env: map[string]string{"CERT": "line1\nline2"}, wantErr: ErrInvalidEnvValue},
+		{name: "carriage return in value", env: map[string]string{"MSG": "a\r"}, wantErr: ErrInvalidEnvValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnvironment(tt.env)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateEnvironment() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
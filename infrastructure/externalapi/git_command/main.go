@@ -2,6 +2,9 @@ package git_command
 
 import (
 	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
 	"systemd-cd/domain/model/git"
 
 	gitcommand "gopkg.in/src-d/go-git.v4"
@@ -22,6 +25,9 @@ func (g *GitCommand) Clone(path git.Path, remoteUrl string, targetBranch string,
 		ReferenceName:     plumbing.NewBranchReferenceName(targetBranch),
 		RecurseSubmodules: gitcommand.DefaultSubmoduleRecursionDepth,
 	})
+	if err == plumbing.ErrReferenceNotFound {
+		return git.ErrRemoteBranchNotExists
+	}
 	return err
 }
 
@@ -61,6 +67,21 @@ func (g *GitCommand) DiffExists(workingDir git.Path, to string) (exists bool, er
 	return headCommit.Hash.String() != revCommit.Hash.String(), nil
 }
 
+func (g *GitCommand) RemoteRefCommitId(workingDir git.Path, branch string) (string, error) {
+	r, err := open(workingDir)
+	if err != nil {
+		return "", err
+	}
+	revHash, err := r.ResolveRevision(plumbing.Revision("origin/" + branch))
+	if err == plumbing.ErrReferenceNotFound {
+		return "", git.ErrRemoteBranchNotExists
+	}
+	if err != nil {
+		return "", err
+	}
+	return revHash.String(), nil
+}
+
 func (g *GitCommand) Pull(workingDir git.Path, force bool) (refCommitId string, err error) {
 	r, err := open(workingDir)
 	if err != nil {
@@ -140,6 +161,33 @@ func (g *GitCommand) GetRemoteUrl(workingDir git.Path, remoteName string) (strin
 	return s[0], nil
 }
 
+// go-git does not support excludes and ignored files, use git CLI.
+func (g *GitCommand) Clean(workingDir git.Path, excludes []string) error {
+	args := []string{"clean", "-fdx"}
+	for _, e := range excludes {
+		args = append(args, "-e", e)
+	}
+	return execGit(workingDir, args...)
+}
+
+// go-git hard reset also removes untracked files, use git CLI
+// to keep files excluded from `Clean()`.
+func (g *GitCommand) Reset(workingDir git.Path) error {
+	return execGit(workingDir, "reset", "--hard")
+}
+
+func execGit(workingDir git.Path, arg ...string) error {
+	_, err := open(workingDir)
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("git", append([]string{"-C", string(workingDir)}, arg...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", arg[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
 func open(dir git.Path) (r *gitcommand.Repository, err error) {
 	r, err = gitcommand.PlainOpen(string(dir))
 	if err == gitcommand.ErrRepositoryNotExists {
@@ -5,7 +5,10 @@ import (
 	"os/exec"
 )
 
-func executeCommand(name string, arg ...string) (exitCode int, stdout bytes.Buffer, stderr bytes.Buffer, err error) {
+// Replaced in tests
+var executeCommand = execCommand
+
+func execCommand(name string, arg ...string) (exitCode int, stdout bytes.Buffer, stderr bytes.Buffer, err error) {
 	cmd := exec.Command(name, arg...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
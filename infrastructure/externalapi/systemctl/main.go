@@ -25,6 +25,7 @@ func (s systemctl) Enable(service string, startNow bool) error {
 	if startNow {
 		command = append(command, "--now")
 	}
+	command = append(command, service)
 	_, _, stderr, err := executeCommand("systemctl", command...)
 	if err != nil {
 		return errors.New(stderr.String())
@@ -37,6 +38,7 @@ func (s systemctl) Disable(service string, stopNow bool) error {
 	if stopNow {
 		command = append(command, "--now")
 	}
+	command = append(command, service)
 	_, _, stderr, err := executeCommand("systemctl", command...)
 	if err != nil {
 		return errors.New(stderr.String())
@@ -60,6 +62,14 @@ func (s systemctl) Stop(service string) error {
 	return nil
 }
 
+func (s systemctl) StopNoBlock(service string) error {
+	_, _, stderr, err := executeCommand("systemctl", "stop", "--no-block", service)
+	if err != nil {
+		return errors.New(stderr.String())
+	}
+	return nil
+}
+
 func (s systemctl) Restart(service string) error {
 	_, _, stderr, err := executeCommand("systemctl", "restart", service)
 	if err != nil {
@@ -68,23 +78,48 @@ func (s systemctl) Restart(service string) error {
 	return nil
 }
 
-func (s systemctl) Status(service string) (systemd.Status, error) {
-	_, stdout, stderr, err := executeCommand("systemctl", "is-active", service)
+func (s systemctl) Reload(service string) error {
+	_, _, stderr, err := executeCommand("systemctl", "reload", service)
 	if err != nil {
-		return "", errors.New(stderr.String())
+		return errors.New(stderr.String())
 	}
-	outs := strings.Split(stdout.String(), "\n")
-	if len(outs) < 1 {
-		return "", systemd.ErrUnitStatusCannotUnmarshal
+	return nil
+}
+
+func (s systemctl) Kill(service string, signal string) error {
+	_, _, stderr, err := executeCommand("systemctl", "kill", "-s", signal, service)
+	if err != nil {
+		return errors.New(stderr.String())
 	}
-	if outs[0] == "active" {
-		return systemd.StatusRunning, nil
+	return nil
+}
+
+func (s systemctl) Verify(unitFilePath string) error {
+	_, _, stderr, err := executeCommand("systemd-analyze", "verify", unitFilePath)
+	if err != nil {
+		return errors.New(stderr.String())
 	}
-	if outs[0] == "inactive" {
+	return nil
+}
+
+func (s systemctl) Status(service string) (systemd.Status, error) {
+	// `systemctl is-active` exits with non-zero code if unit is not active,
+	// so check stdout before error.
+	_, stdout, stderr, err := executeCommand("systemctl", "is-active", service)
+	outs := strings.Split(stdout.String(), "\n")
+	switch outs[0] {
+	case "active":
+		return systemd.StatusRunning, nil
+	case "activating", "deactivating", "reloading":
+		// process still alive
+		return systemd.StatusTransitioning, nil
+	case "inactive":
 		return systemd.StatusStopped, nil
-	}
-	if outs[0] == "failed" {
+	case "failed":
 		return systemd.StatusFailed, nil
 	}
+	if err != nil {
+		return "", errors.New(stderr.String())
+	}
 	return "", systemd.ErrUnitStatusCannotUnmarshal
 }
@@ -0,0 +1,111 @@
+package systemctl
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"systemd-cd/domain/model/systemd"
+	"testing"
+)
+
+// Replace `executeCommand` to record argv and return `stdout`, `err`.
+func fakeExecuteCommand(t *testing.T, stdout string, err error) *[][]string {
+	calls := &[][]string{}
+	orig := executeCommand
+	t.Cleanup(func() { executeCommand = orig })
+	executeCommand = func(name string, arg ...string) (int, bytes.Buffer, bytes.Buffer, error) {
+		*calls = append(*calls, append([]string{name}, arg...))
+		exitCode := 0
+		if err != nil {
+			exitCode = 1
+		}
+		return exitCode, *bytes.NewBufferString(stdout), bytes.Buffer{}, err
+	}
+	return calls
+}
+
+func Test_systemctl_argv(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(s systemd.Systemctl) error
+		want []string
+	}{
+		{
+			name: "enable",
+			f:    func(s systemd.Systemctl) error { return s.Enable("app", false) },
+			want: []string{"systemctl", "enable", "app"},
+		},
+		{
+			name: "enable and start",
+			f:    func(s systemd.Systemctl) error { return s.Enable("app", true) },
+			want: []string{"systemctl", "enable", "--now", "app"},
+		},
+		{
+			name: "disable",
+			f:    func(s systemd.Systemctl) error { return s.Disable("app", false) },
+			want: []string{"systemctl", "disable", "app"},
+		},
+		{
+			name: "disable and stop",
+			f:    func(s systemd.Systemctl) error { return s.Disable("app", true) },
+			want: []string{"systemctl", "disable", "--now", "app"},
+		},
+		{
+			name: "stop",
+			f:    func(s systemd.Systemctl) error { return s.Stop("app") },
+			want: []string{"systemctl", "stop", "app"},
+		},
+		{
+			name: "stop without blocking",
+			f:    func(s systemd.Systemctl) error { return s.StopNoBlock("app") },
+			want: []string{"systemctl", "stop", "--no-block", "app"},
+		},
+		{
+			name: "kill",
+			f:    func(s systemd.Systemctl) error { return s.Kill("app", "SIGKILL") },
+			want: []string{"systemctl", "kill", "-s", "SIGKILL", "app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeExecuteCommand(t, "", nil)
+			err := tt.f(New())
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if len(*calls) != 1 || !reflect.DeepEqual((*calls)[0], tt.want) {
+				t.Errorf("argv = %v, want [%v]", *calls, strings.Join(tt.want, " "))
+			}
+		})
+	}
+}
+
+func Test_systemctl_Status(t *testing.T) {
+	errInactive := errors.New("exit status 3")
+
+	tests := []struct {
+		stdout string
+		err    error
+		want   systemd.Status
+	}{
+		{stdout: "active\n", want: systemd.StatusRunning},
+		{stdout: "activating\n", err: errInactive, want: systemd.StatusTransitioning},
+		{stdout: "deactivating\n", err: errInactive, want: systemd.StatusTransitioning},
+		{stdout: "reloading\n", want: systemd.StatusTransitioning},
+		{stdout: "inactive\n", err: errInactive, want: systemd.StatusStopped},
+		{stdout: "failed\n", err: errInactive, want: systemd.StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.stdout), func(t *testing.T) {
+			fakeExecuteCommand(t, tt.stdout, tt.err)
+			got, err := New().Status("app")
+			if err != nil {
+				t.Fatalf("Status() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Status() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package systemctl
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"systemd-cd/domain/model/logger"
+	"systemd-cd/domain/model/systemd"
+	"time"
+)
+
+// Max length of error message in trace log
+const traceErrMaxLen = 256
+
+// Max number of calls kept by `Traced`, older calls are dropped
+const traceMaxCalls = 1000
+
+// Arguments like `TOKEN=xxx`, `password=xxx`
+var secretArgRegexp = regexp.MustCompile(`(?i)^([^=]*(token|secret|password|passwd|key)[^=]*)=.*$`)
+
+type Call struct {
+	Method   string
+	Args     []string
+	Duration time.Duration
+	Err      error
+}
+
+// Wrap `systemd.Systemctl` to log each call at debug level.
+// Use only when tracing enabled, unwrapped implementation has no overhead.
+func NewTraced(s systemd.Systemctl, l logger.LoggerI) *Traced {
+	return &Traced{systemctl: s, logger: l}
+}
+
+// implements "systemd-cd/domain/model/systemd".Systemctl
+type Traced struct {
+	systemctl systemd.Systemctl
+	logger    logger.LoggerI
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Traced calls in order, up to last `traceMaxCalls` calls.
+func (t *Traced) Calls() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Call{}, t.calls...)
+}
+
+// Clear traced calls. e.g. before each deploy
+func (t *Traced) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = nil
+}
+
+func (t *Traced) trace(method string, args []string, f func() error) error {
+	start := time.Now()
+	err := f()
+	c := Call{Method: method, Args: redact(args), Duration: time.Since(start), Err: err}
+
+	t.mu.Lock()
+	if len(t.calls) == traceMaxCalls {
+		// drop oldest call
+		copy(t.calls, t.calls[1:])
+		t.calls = t.calls[:len(t.calls)-1]
+	}
+	t.calls = append(t.calls, c)
+	t.mu.Unlock()
+
+	if err != nil {
+		msg := err.Error()
+		if len(msg) > traceErrMaxLen {
+			msg = msg[:traceErrMaxLen] + "..."
+		}
+		t.logger.Debugf("systemctl %s %s (%v): %s", c.Method, strings.Join(c.Args, " "), c.Duration, msg)
+	} else {
+		t.logger.Debugf("systemctl %s %s (%v)", c.Method, strings.Join(c.Args, " "), c.Duration)
+	}
+	return err
+}
+
+func redact(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, a := range args {
+		redacted[i] = secretArgRegexp.ReplaceAllString(a, "$1=***")
+	}
+	return redacted
+}
+
+func (t *Traced) DaemonReload() error {
+	return t.trace("daemon-reload", nil, t.systemctl.DaemonReload)
+}
+
+func (t *Traced) Enable(service string, startNow bool) error {
+	args := []string{service}
+	if startNow {
+		args = []string{"--now", service}
+	}
+	return t.trace("enable", args, func() error { return t.systemctl.Enable(service, startNow) })
+}
+
+func (t *Traced) Disable(service string, stopNow bool) error {
+	args := []string{service}
+	if stopNow {
+		args = []string{"--now", service}
+	}
+	return t.trace("disable", args, func() error { return t.systemctl.Disable(service, stopNow) })
+}
+
+func (t *Traced) Start(service string) error {
+	return t.trace("start", []string{service}, func() error { return t.systemctl.Start(service) })
+}
+
+func (t *Traced) Stop(service string) error {
+	return t.trace("stop", []string{service}, func() error { return t.systemctl.Stop(service) })
+}
+
+func (t *Traced) StopNoBlock(service string) error {
+	return t.trace("stop", []string{"--no-block", service}, func() error { return t.systemctl.StopNoBlock(service) })
+}
+
+func (t *Traced) Restart(service string) error {
+	return t.trace("restart", []string{service}, func() error { return t.systemctl.Restart(service) })
+}
+
+func (t *Traced) Reload(service string) error {
+	return t.trace("reload", []string{service}, func() error { return t.systemctl.Reload(service) })
+}
+
+func (t *Traced) Kill(service string, signal string) error {
+	return t.trace("kill", []string{"-s", signal, service}, func() error { return t.systemctl.Kill(service, signal) })
+}
+
+func (t *Traced) Status(service string) (s systemd.Status, err error) {
+	err = t.trace("is-active", []string{service}, func() error {
+		s, err = t.systemctl.Status(service)
+		return err
+	})
+	return
+}
+
+func (t *Traced) Verify(unitFilePath string) error {
+	return t.trace("verify", []string{unitFilePath}, func() error {
+		return t.systemctl.Verify(unitFilePath)
+	})
+}
@@ -0,0 +1,134 @@
+package systemctl
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"systemd-cd/domain/model/logger"
+	"systemd-cd/domain/model/systemd"
+	"testing"
+)
+
+// Records debug logs, other methods are not implemented.
+type recordLogger struct {
+	logger.LoggerI
+	logs []string
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+// Fake implementation returns `err` for every call.
+type fakeSystemctl struct{ err error }
+
+func (s fakeSystemctl) DaemonReload() error                        { return s.err }
+func (s fakeSystemctl) Enable(service string, startNow bool) error { return s.err }
+func (s fakeSystemctl) Disable(service string, stopNow bool) error { return s.err }
+func (s fakeSystemctl) Start(service string) error                 { return s.err }
+func (s fakeSystemctl) Stop(service string) error                  { return s.err }
+func (s fakeSystemctl) StopNoBlock(service string) error           { return s.err }
+func (s fakeSystemctl) Restart(service string) error               { return s.err }
+func (s fakeSystemctl) Reload(service string) error                { return s.err }
+func (s fakeSystemctl) Kill(service string, signal string) error   { return s.err }
+func (s fakeSystemctl) Verify(unitFilePath string) error           { return s.err }
+func (s fakeSystemctl) Status(service string) (systemd.Status, error) {
+	return systemd.StatusRunning, s.err
+}
+
+func TestTraced(t *testing.T) {
+	errFailed := errors.New("Job for app.service failed.")
+
+	tests := []struct {
+		name      string
+		err       error
+		f         func(s *Traced)
+		wantCalls []Call
+	}{
+		{
+			name: "calls in order",
+			f: func(s *Traced) {
+				s.DaemonReload()
+				s.Enable("app", true)
+				s.Restart("app")
+				s.Status("app")
+			},
+			wantCalls: []Call{
+				{Method: "daemon-reload", Args: []string{}},
+				{Method: "enable", Args: []string{"--now", "app"}},
+				{Method: "restart", Args: []string{"app"}},
+				{Method: "is-active", Args: []string{"app"}},
+			},
+		},
+		{
+			name: "error",
+			err:  errFailed,
+			f: func(s *Traced) {
+				s.Kill("app", "SIGKILL")
+			},
+			wantCalls: []Call{
+				{Method: "kill", Args: []string{"-s", "SIGKILL", "app"}, Err: errFailed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &recordLogger{}
+			s := NewTraced(fakeSystemctl{tt.err}, l)
+			tt.f(s)
+
+			got := s.Calls()
+			if len(got) != len(tt.wantCalls) {
+				t.Fatalf("Calls() = %v, want %v", got, tt.wantCalls)
+			}
+			for i := range got {
+				got[i].Duration = 0
+			}
+			if !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("Calls() = %v, want %v", got, tt.wantCalls)
+			}
+			if len(l.logs) != len(tt.wantCalls) {
+				t.Errorf("debug logs = %v, want %v lines", l.logs, len(tt.wantCalls))
+			}
+		})
+	}
+}
+
+func TestTraced_maxCalls(t *testing.T) {
+	s := NewTraced(fakeSystemctl{}, &recordLogger{})
+	for i := 0; i <= traceMaxCalls; i++ {
+		s.Start(fmt.Sprintf("app-%d", i))
+	}
+
+	got := s.Calls()
+	if len(got) != traceMaxCalls {
+		t.Fatalf("len(Calls()) = %v, want %v", len(got), traceMaxCalls)
+	}
+	// oldest call is dropped
+	if got[0].Args[0] != "app-1" || got[len(got)-1].Args[0] != fmt.Sprintf("app-%d", traceMaxCalls) {
+		t.Errorf("Calls() = [%v ... %v], want [app-1 ... app-%d]", got[0].Args, got[len(got)-1].Args, traceMaxCalls)
+	}
+
+	s.Reset()
+	if got := s.Calls(); len(got) != 0 {
+		t.Errorf("Calls() after Reset() = %v, want empty", got)
+	}
+}
+
+func Test_redact(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "no secrets", args: []string{"--now", "app"}, want: []string{"--now", "app"}},
+		{name: "secrets", args: []string{"GIT_TOKEN=abc", "db_password=p", "PORT=80"}, want: []string{"GIT_TOKEN=***", "db_password=***", "PORT=80"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
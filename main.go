@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"systemd-cd/application/flag_with_env"
 	"systemd-cd/application/logrus"
 	"systemd-cd/application/systemd"
@@ -21,6 +23,16 @@ var (
 	systemdUnitFileDestDir    = flag_with_env.String("systemd-unit-file-dest-dir", "SYSTEMD_UNIT_FILE_DEST_DIR", "/usr/local/lib/systemd/system/", "")
 	systemdUnitEnvFileDestDir = flag_with_env.String("systemd-unit-env-file-dest-dir", "SYSTEMD_UNIT_ENV_FILE_DEST_DIR", "/usr/local/systemd-cd/etc/default/", "")
 	backupDestDir             = flag_with_env.String("backup-dest-dir", "BACKUP_DEST_DIR", "/var/backups/systemd-cd/", "")
+	umask                     = flag_with_env.String("umask", "UMASK", "", "Umask of generated unit/env files (e.g. 0077)")
+	traceSystemctl            = flag_with_env.Bool("trace-systemctl", "TRACE_SYSTEMCTL", false, "Log each systemctl call at debug level")
+	allowDangerousActions     = flag_with_env.Bool("allow-dangerous-actions", "ALLOW_DANGEROUS_ACTIONS", false, "Allow unit actions affecting host (e.g. StartLimitAction=reboot)")
+	systemdVersion            = flag_with_env.Uint("systemd-version", "SYSTEMD_VERSION", 0, "Version of systemd on host, enables directives requiring newer systemd (e.g. 250 for ExecSearchPath=)")
+	noReload                  = flag_with_env.Bool("no-reload", "NO_RELOAD", false, "Skip daemon-reload after deploy, run systemctl daemon-reload to apply changes")
+	checkPrincipals           = flag_with_env.Bool("check-principals", "CHECK_PRINCIPALS", false, "Check User= and Group= exist on host before writing unit files")
+	createUser                = flag_with_env.Bool("create-user", "CREATE_USER", false, "Create missing User= as system user (requires -check-principals)")
+	resolveExecPath           = flag_with_env.Bool("resolve-exec-path", "RESOLVE_EXEC_PATH", false, "Resolve relative ExecStart= executable in -exec-path (default: relative ExecStart= is rejected)")
+	execPath                  = flag_with_env.String("exec-path", "EXEC_PATH", "", "Colon separated directories to resolve executables (empty: PATH env)")
+	execAllowlist             = flag_with_env.String("exec-allowlist", "EXEC_ALLOWLIST", "", "Comma separated executables or directories allowed in Exec*= (empty: allow all)")
 )
 
 func main() {
@@ -31,12 +43,43 @@ func main() {
 	l := logrus.New()
 	l.SetLevel(logger.Level(*logLevel))
 
-	i, err := systemd.New(systemctl.New(), *systemdUnitFileDestDir)
+	var fileUmask *os.FileMode
+	if *umask != "" {
+		m, err := strconv.ParseUint(*umask, 8, 32)
+		if err != nil {
+			fmt.Printf("err: invalid umask: %v\n", err)
+			os.Exit(1)
+		}
+		fm := os.FileMode(m)
+		fileUmask = &fm
+	}
+
+	var allowlist []string
+	if *execAllowlist != "" {
+		allowlist = strings.Split(*execAllowlist, ",")
+	}
+
+	sc := systemctl.New()
+	if *traceSystemctl {
+		sc = systemctl.NewTraced(sc, l)
+	}
+
+	i, err := systemd.New(sc, *systemdUnitFileDestDir, systemd.Option{
+		AllowDangerousActions: *allowDangerousActions,
+		Umask:                 fileUmask,
+		EnvironmentFileDir:    *systemdUnitEnvFileDestDir,
+		ExecAllowlist:         allowlist,
+		SystemdVersion:        *systemdVersion,
+		NoReload:              *noReload,
+		CheckPrincipals:       *checkPrincipals,
+		CreateUser:            *createUser,
+		ResolveExecPath:       *resolveExecPath,
+		ExecPath:              *execPath,
+	})
 	if err != nil {
 		fmt.Printf("err: %v\n", err)
 		os.Exit(1)
 	}
-	envFile := *systemdUnitEnvFileDestDir + "system-cd-go"
 	us, err := i.NewService(
 		"systemd-cd-go",
 		systemd.UnitFileService{
@@ -50,8 +93,8 @@ func main() {
 			},
 			Service: systemd.ServiceDirective{
 				Type:            &systemd.UnitTypeSimple,
-				EnvironmentFile: &envFile,
-				ExecStart:       "watch tail /var/log/syslog",
+				EnvironmentFile: nil,
+				ExecStart:       systemd.ExecCommand{Command: "/usr/bin/watch tail /var/log/syslog"},
 				ExecStop:        nil,
 				ExecReload:      nil,
 				Restart:         nil,
@@ -71,6 +114,12 @@ func main() {
 		fmt.Printf("err: %v\n", err)
 		os.Exit(1)
 	}
+	if i.ReloadPending() {
+		l.Warn("daemon-reload pending, changes of unit files are not applied")
+	}
+	if _, conflicts := us.EffectiveEnvironment(); len(conflicts) != 0 {
+		l.Warnf("Environment= overrides EnvironmentFile= values of %v", strings.Join(conflicts, ", "))
+	}
 	s, err := us.GetStatus()
 	if err != nil {
 		fmt.Printf("err: %v\n", err)